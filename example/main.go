@@ -19,7 +19,9 @@ type User struct {
 func main() {
 	orm.Setup("go-eloquent-mongo", "127.0.0.1", "27017", "")
 	ctx := context.Background()
-	orm.Connect(ctx)
+	if _, err := orm.Connect(ctx); err != nil {
+		log.Fatal(err)
+	}
 	defer orm.Disconnect(ctx)
 
 	userOrm := orm.NewEloquent[User]("users")
@@ -0,0 +1,288 @@
+package orm
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Pipeline is a chainable aggregation pipeline builder, pass it to Aggregate
+type Pipeline struct {
+	stages mongo.Pipeline
+}
+
+/**
+ * @title create an empty aggregation pipeline
+ */
+func NewPipeline() *Pipeline {
+	return &Pipeline{stages: mongo.Pipeline{}}
+}
+
+/**
+ * @title append a raw stage for operators not covered by the builder
+ * @param stage bson.D ex: bson.D{{Key: "$sample", Value: bson.M{"size": 3}}}
+ */
+func (p *Pipeline) Stage(stage bson.D) *Pipeline {
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+func (p *Pipeline) add(operator string, value any) *Pipeline {
+	return p.Stage(bson.D{{Key: operator, Value: value}})
+}
+
+/**
+ * @title filter documents
+ * @param filter any query condition, ex: bson.M{"age": bson.M{"$gte": 18}} or Query().Filter()
+ */
+func (p *Pipeline) Match(filter any) *Pipeline {
+	return p.add("$match", filter)
+}
+
+/**
+ * @title group documents
+ * @param id any group key, ex: "$age", bson.M{"year": bson.M{"$year": "$created_at"}}, nil for all documents
+ * @param fields map[string]any accumulators, ex: bson.M{"count": bson.M{"$sum": 1}}
+ */
+func (p *Pipeline) Group(id any, fields map[string]any) *Pipeline {
+	group := bson.D{{Key: "_id", Value: id}}
+	for _, key := range sortedKeys(fields) {
+		group = append(group, bson.E{Key: key, Value: fields[key]})
+	}
+	return p.add("$group", group)
+}
+
+/**
+ * @title reshape documents
+ * @param spec any ex: bson.M{"name": 1, "total": bson.M{"$add": bson.A{"$a", "$b"}}}
+ */
+func (p *Pipeline) Project(spec any) *Pipeline {
+	return p.add("$project", spec)
+}
+
+/**
+ * @title add or replace fields
+ * @param fields any ex: bson.M{"adult": bson.M{"$gte": bson.A{"$age", 18}}}
+ */
+func (p *Pipeline) AddFields(fields any) *Pipeline {
+	return p.add("$addFields", fields)
+}
+
+/**
+ * @title sort documents
+ * @param fields ...string field name, prefix "-" for descending. ex: Sort("-count", "_id")
+ */
+func (p *Pipeline) Sort(fields ...string) *Pipeline {
+	return p.add("$sort", Index(fields...).keys)
+}
+
+func (p *Pipeline) Limit(limit int64) *Pipeline {
+	return p.add("$limit", limit)
+}
+
+func (p *Pipeline) Skip(skip int64) *Pipeline {
+	return p.add("$skip", skip)
+}
+
+/**
+ * @title output a document for each element of an array field
+ * @param path string array field, with or without "$" prefix
+ * @param preserveNullAndEmpty ...bool keep documents whose array is missing or empty. default=false
+ */
+func (p *Pipeline) Unwind(path string, preserveNullAndEmpty ...bool) *Pipeline {
+	path = "$" + strings.TrimPrefix(path, "$")
+	if len(preserveNullAndEmpty) > 0 && preserveNullAndEmpty[0] {
+		return p.add("$unwind", bson.D{{Key: "path", Value: path}, {Key: "preserveNullAndEmptyArrays", Value: true}})
+	}
+	return p.add("$unwind", path)
+}
+
+/**
+ * @title left outer join another collection by equality
+ * @param from string collection to join
+ * @param as string output array field
+ */
+func (p *Pipeline) Lookup(from, localField, foreignField, as string) *Pipeline {
+	return p.add("$lookup", bson.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: localField},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	})
+}
+
+/**
+ * @title run several pipelines on the same input documents
+ * @param facets map[string]*Pipeline output field and its pipeline
+ */
+func (p *Pipeline) Facet(facets map[string]*Pipeline) *Pipeline {
+	facet := bson.D{}
+	keys := make([]string, 0, len(facets))
+	for key := range facets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		facet = append(facet, bson.E{Key: key, Value: facets[key].Stages()})
+	}
+	return p.add("$facet", facet)
+}
+
+/**
+ * @title categorize documents into buckets by boundaries
+ * @param groupBy any expression, ex: "$age"
+ * @param boundaries []any ascending lower bounds, ex: []any{0, 18, 65, 200}
+ * @param defaultBucket any bucket id of documents out of boundaries, nil to reject them
+ * @param output map[string]any accumulators, nil for count only
+ */
+func (p *Pipeline) Bucket(groupBy any, boundaries []any, defaultBucket any, output map[string]any) *Pipeline {
+	bucket := bson.D{{Key: "groupBy", Value: groupBy}, {Key: "boundaries", Value: boundaries}}
+	if defaultBucket != nil {
+		bucket = append(bucket, bson.E{Key: "default", Value: defaultBucket})
+	}
+	if output != nil {
+		bucket = append(bucket, bson.E{Key: "output", Value: output})
+	}
+	return p.add("$bucket", bucket)
+}
+
+/**
+ * @title count documents into a field
+ * @param field string output field name
+ */
+func (p *Pipeline) Count(field string) *Pipeline {
+	return p.add("$count", field)
+}
+
+/**
+ * @title get stages of pipeline
+ */
+func (p *Pipeline) Stages() mongo.Pipeline {
+	return p.stages
+}
+
+// leadingStages must be the first stage of a pipeline, the soft delete $match is inserted after them
+var leadingStages = map[string]bool{
+	"$geoNear":      true,
+	"$search":       true,
+	"$vectorSearch": true,
+	"$collStats":    true,
+	"$indexStats":   true,
+}
+
+/**
+ * @title run an aggregation, soft deleted documents are filtered out first unless WithTrashed is used,
+ * stages which must come first (ex: $geoNear, $search) are kept first
+ * @param pipeline any *Pipeline, mongo.Pipeline, []bson.D, []bson.M ...
+ * @return cursor *mongo.Cursor caller must close it
+ * @return err error fail message from query
+ */
+func (e *Eloquent[T]) Aggregate(ctx context.Context, pipeline any, opts ...*options.AggregateOptions) (cursor *mongo.Cursor, err error) {
+	coll, errConn := e.collection("Aggregate")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	stages := pipelineStages(pipeline)
+	if scope := e.scope(nil); scope != nil {
+		at := 0
+		if len(stages) > 0 && leadingStages[stageName(stages[0])] {
+			at = 1
+		}
+		match := bson.D{{Key: "$match", Value: scope}}
+		stages = append(stages[:at], append([]any{match}, stages[at:]...)...)
+	}
+
+	cursor, errA := coll.Aggregate(ctx, stages, opts...)
+	if errA != nil {
+		logger.LogDebug.Error(e.logTitle, errA, getCurrentFuncInfo(1))
+		err = e.errMsg("Aggregate", errA)
+		return
+	}
+	return
+}
+
+// Aggregator is implemented by every eloquent
+type Aggregator interface {
+	Aggregate(ctx context.Context, pipeline any, opts ...*options.AggregateOptions) (cursor *mongo.Cursor, err error)
+}
+
+/**
+ * @title run an aggregation of eloquent and decode results into R
+ * @param source Aggregator eloquent, ex: userOrm
+ * @param pipeline any *Pipeline, mongo.Pipeline, []bson.D, []bson.M ...
+ * @return results []*R
+ * @return err error fail message from query
+ */
+func Aggregate[R any](ctx context.Context, source Aggregator, pipeline any, opts ...*options.AggregateOptions) (results []*R, err error) {
+	cursor, err := source.Aggregate(ctx, pipeline, opts...)
+	if err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	results = []*R{}
+	if errA := cursor.All(ctx, &results); errA != nil {
+		logger.LogDebug.Error("[aggregate] : ", errA, getCurrentFuncInfo(1))
+		err = newError("", "Aggregate", errA)
+		return
+	}
+	return
+}
+
+// pipelineStages convert pipeline to a slice of stages
+func pipelineStages(pipeline any) []any {
+	if p, ok := pipeline.(*Pipeline); ok {
+		pipeline = p.Stages()
+	}
+
+	stages := []any{}
+	value := reflect.ValueOf(pipeline)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		if pipeline != nil {
+			stages = append(stages, pipeline)
+		}
+		return stages
+	}
+
+	for i := 0; i < value.Len(); i++ {
+		stages = append(stages, value.Index(i).Interface())
+	}
+	return stages
+}
+
+// stageName get operator of a single stage, ex: $match
+func stageName(stage any) string {
+	switch s := stage.(type) {
+	case bson.D:
+		if len(s) > 0 {
+			return s[0].Key
+		}
+	case bson.M:
+		for key := range s {
+			return key
+		}
+	case map[string]any:
+		for key := range s {
+			return key
+		}
+	}
+	return ""
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,484 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// operators maps the comparison operators accepted by Where to mongodb query operators
+var operators = map[string]string{
+	"=":  "$eq",
+	"!=": "$ne",
+	"<>": "$ne",
+	">":  "$gt",
+	">=": "$gte",
+	"<":  "$lt",
+	"<=": "$lte",
+}
+
+// Builder is a chainable query builder for an eloquent model.
+// conditions added by Where are joined by $and, OrWhere starts a new group joined by $or
+type Builder[T any] struct {
+	eloquent IEloquent[T]
+	groups   [][]bson.M
+	sort     bson.D
+	limit    int64
+	skip     int64
+	// the first invalid condition, returned by methods running the query
+	err error
+}
+
+func newBuilder[T any](eloquent IEloquent[T]) *Builder[T] {
+	return &Builder[T]{
+		eloquent: eloquent,
+		groups:   [][]bson.M{{}},
+	}
+}
+
+/**
+ * @title add a condition joined by and
+ * @param field string field name of document
+ * @param args ...any value, or operator and value. ex: Where("age", 18), Where("age", ">=", 18), Where("age", "$gte", 18).
+ * an unknown operator fails the query with ErrInvalidQuery
+ */
+func (b *Builder[T]) Where(field string, args ...any) *Builder[T] {
+	b.push(field, args...)
+	return b
+}
+
+/**
+ * @title add a condition joined by or
+ * @param field string field name of document
+ * @param args ...any value, or operator and value. same as Where
+ */
+func (b *Builder[T]) OrWhere(field string, args ...any) *Builder[T] {
+	b.groups = append(b.groups, []bson.M{})
+	b.push(field, args...)
+	return b
+}
+
+/**
+ * @title field value must be one of values
+ * @param values ...any values, or a single slice of values. ex: WhereIn("name", "a", "b"), WhereIn("name", names)
+ */
+func (b *Builder[T]) WhereIn(field string, values ...any) *Builder[T] {
+	return b.Where(field, "$in", flattenValues(values))
+}
+
+/**
+ * @title field value must not be one of values
+ * @param values ...any values, or a single slice of values
+ */
+func (b *Builder[T]) WhereNotIn(field string, values ...any) *Builder[T] {
+	return b.Where(field, "$nin", flattenValues(values))
+}
+
+/**
+ * @title field value must be between min and max (inclusive)
+ */
+func (b *Builder[T]) WhereBetween(field string, min, max any) *Builder[T] {
+	b.add(bson.M{field: bson.M{"$gte": min, "$lte": max}})
+	return b
+}
+
+/**
+ * @title field must be null or missing
+ */
+func (b *Builder[T]) WhereNull(field string) *Builder[T] {
+	return b.Where(field, nil)
+}
+
+/**
+ * @title field must exist and not be null
+ */
+func (b *Builder[T]) WhereNotNull(field string) *Builder[T] {
+	return b.Where(field, "$ne", nil)
+}
+
+/**
+ * @title sort result by field
+ * @param direction string asc or desc. default=asc
+ */
+func (b *Builder[T]) OrderBy(field string, direction ...string) *Builder[T] {
+	order := 1
+	if len(direction) > 0 && strings.ToLower(direction[0]) == "desc" {
+		order = -1
+	}
+	b.sort = append(b.sort, bson.E{Key: field, Value: order})
+	return b
+}
+
+/**
+ * @title limit document count of result
+ */
+func (b *Builder[T]) Limit(limit int) *Builder[T] {
+	b.limit = int64(limit)
+	return b
+}
+
+/**
+ * @title skip documents of result
+ */
+func (b *Builder[T]) Skip(skip int) *Builder[T] {
+	b.skip = int64(skip)
+	return b
+}
+
+/**
+ * @title compile conditions to mongodb filter
+ * @return filter bson.M
+ */
+func (b *Builder[T]) Filter() bson.M {
+	var groups []bson.M
+	for _, group := range b.groups {
+		switch len(group) {
+		case 0:
+		case 1:
+			groups = append(groups, group[0])
+		default:
+			and := bson.A{}
+			for _, cond := range group {
+				and = append(and, cond)
+			}
+			groups = append(groups, bson.M{"$and": and})
+		}
+	}
+
+	switch len(groups) {
+	case 0:
+		return bson.M{}
+	case 1:
+		return groups[0]
+	default:
+		or := bson.A{}
+		for _, group := range groups {
+			or = append(or, group)
+		}
+		return bson.M{"$or": or}
+	}
+}
+
+/**
+ * @title get documents matching the query
+ * @return models []*T your model slice
+ * @return err error fail message from query
+ */
+func (b *Builder[T]) Get(ctx context.Context) (models []*T, err error) {
+	if err = b.check("Get"); err != nil {
+		return
+	}
+	models, err = b.eloquent.FindMultiple(ctx, b.Filter(), b.findOptions())
+	return
+}
+
+/**
+ * @title stream documents matching the query by a typed cursor
+ * @return cursor *Cursor[T] caller must close it
+ */
+func (b *Builder[T]) Cursor(ctx context.Context) (cursor *Cursor[T], err error) {
+	if err = b.check("Cursor"); err != nil {
+		return
+	}
+	cursor, err = b.eloquent.Cursor(ctx, b.Filter(), b.findOptions())
+	return
+}
+
+/**
+ * @title call fn with documents matching the query in batches of size
+ */
+func (b *Builder[T]) Chunk(ctx context.Context, size int, fn func([]*T) error) (err error) {
+	if err = b.check("Chunk"); err != nil {
+		return
+	}
+	err = b.eloquent.Chunk(ctx, b.Filter(), size, fn, b.findOptions())
+	return
+}
+
+/**
+ * @title call fn with each document matching the query
+ */
+func (b *Builder[T]) Each(ctx context.Context, fn func(*T) error) (err error) {
+	if err = b.check("Each"); err != nil {
+		return
+	}
+	err = b.eloquent.Each(ctx, b.Filter(), fn, b.findOptions())
+	return
+}
+
+/**
+ * @title get first document matching the query
+ * @return model *T your model struct
+ * @return err error ErrNotFound if nothing matched
+ */
+func (b *Builder[T]) First(ctx context.Context) (model *T, err error) {
+	if err = b.check("First"); err != nil {
+		return
+	}
+	opts := b.findOptions().SetLimit(1)
+	models, errF := b.eloquent.FindMultiple(ctx, b.Filter(), opts)
+	if errF != nil {
+		err = errF
+		return
+	}
+
+	if len(models) == 0 {
+		err = b.errMsg("First", mongo.ErrNoDocuments)
+		return
+	}
+
+	model = models[0]
+	return
+}
+
+/**
+ * @title count documents matching the query. limit and skip are ignored
+ */
+func (b *Builder[T]) Count(ctx context.Context) (count int, err error) {
+	if err = b.check("Count"); err != nil {
+		return
+	}
+	count, err = b.eloquent.Count(ctx, b.Filter())
+	return
+}
+
+/**
+ * @title sum of a numeric field of documents matching the query
+ */
+func (b *Builder[T]) Sum(ctx context.Context, field string) (sum float64, err error) {
+	if err = b.check("Sum"); err != nil {
+		return
+	}
+	sum, err = b.eloquent.Sum(ctx, field, b.Filter())
+	return
+}
+
+/**
+ * @title average of a numeric field of documents matching the query
+ */
+func (b *Builder[T]) Avg(ctx context.Context, field string) (avg float64, err error) {
+	if err = b.check("Avg"); err != nil {
+		return
+	}
+	avg, err = b.eloquent.Avg(ctx, field, b.Filter())
+	return
+}
+
+/**
+ * @title minimum value of a field of documents matching the query
+ */
+func (b *Builder[T]) Min(ctx context.Context, field string) (min any, err error) {
+	if err = b.check("Min"); err != nil {
+		return
+	}
+	min, err = b.eloquent.Min(ctx, field, b.Filter())
+	return
+}
+
+/**
+ * @title maximum value of a field of documents matching the query
+ */
+func (b *Builder[T]) Max(ctx context.Context, field string) (max any, err error) {
+	if err = b.check("Max"); err != nil {
+		return
+	}
+	max, err = b.eloquent.Max(ctx, field, b.Filter())
+	return
+}
+
+/**
+ * @title distinct values of a field of documents matching the query
+ */
+func (b *Builder[T]) Distinct(ctx context.Context, field string) (values []any, err error) {
+	if err = b.check("Distinct"); err != nil {
+		return
+	}
+	values, err = b.eloquent.Distinct(ctx, field, b.Filter())
+	return
+}
+
+/**
+ * @title values of a field of documents matching the query, sorted by OrderBy and limited by Limit and Skip
+ */
+func (b *Builder[T]) Pluck(ctx context.Context, field string) (values []any, err error) {
+	if err = b.check("Pluck"); err != nil {
+		return
+	}
+	values, err = b.eloquent.Pluck(ctx, field, b.Filter(), b.findOptions())
+	return
+}
+
+/**
+ * @title delete documents matching the query. limit and skip are ignored
+ */
+func (b *Builder[T]) Delete(ctx context.Context) (deleteCount int, err error) {
+	if err = b.check("Delete"); err != nil {
+		return
+	}
+	deleteCount, err = b.eloquent.DeleteMultiple(ctx, b.Filter())
+	return
+}
+
+/**
+ * @title update documents matching the query. limit and skip are ignored
+ */
+func (b *Builder[T]) Update(ctx context.Context, data any) (modifiedCount int, err error) {
+	if err = b.check("Update"); err != nil {
+		return
+	}
+	modifiedCount, err = b.eloquent.UpdateMultiple(ctx, b.Filter(), data)
+	return
+}
+
+/**
+ * @title paginate documents matching the query, sorted by OrderBy
+ */
+func (b *Builder[T]) Paginate(ctx context.Context, limit int, page int) (paginated *Pagination[T], err error) {
+	if err = b.check("Paginate"); err != nil {
+		return
+	}
+	paginated, err = b.eloquent.Paginate(ctx, limit, page, b.Filter(), b.sortOptions()...)
+	return
+}
+
+/**
+ * @title paginate documents matching the query by page and per_page of request, sorted by OrderBy
+ */
+func (b *Builder[T]) PaginateRequest(r *http.Request) (paginated *Pagination[T], err error) {
+	if err = b.check("PaginateRequest"); err != nil {
+		return
+	}
+	paginated, err = b.eloquent.PaginateRequest(r, b.Filter(), b.sortOptions()...)
+	return
+}
+
+/**
+ * @title paginate documents matching the query without counting, sorted by OrderBy
+ */
+func (b *Builder[T]) SimplePaginate(ctx context.Context, limit int, page int) (paginated *SimplePagination[T], err error) {
+	if err = b.check("SimplePaginate"); err != nil {
+		return
+	}
+	paginated, err = b.eloquent.SimplePaginate(ctx, limit, page, b.Filter(), b.sortOptions()...)
+	return
+}
+
+/**
+ * @title paginate matched documents by cursor, sorted by OrderBy
+ * @param cursor string NextCursor or PrevCursor of the previous call, empty for the first page
+ */
+func (b *Builder[T]) CursorPaginate(ctx context.Context, limit int, cursor string) (paginated *CursorPagination[T], err error) {
+	if err = b.check("CursorPaginate"); err != nil {
+		return
+	}
+	sortFields := []string{}
+	for _, key := range b.sort {
+		if key.Value == -1 {
+			sortFields = append(sortFields, "-"+key.Key)
+		} else {
+			sortFields = append(sortFields, key.Key)
+		}
+	}
+	paginated, err = b.eloquent.CursorPaginate(ctx, limit, cursor, b.Filter(), sortFields...)
+	return
+}
+
+// check return the error of an invalid condition
+func (b *Builder[T]) check(operation string) (err error) {
+	if b.err != nil {
+		err = b.errMsg(operation, b.err)
+	}
+	return
+}
+
+// errMsg wrap cause like the errors of eloquent, with collection name if it is known
+func (b *Builder[T]) errMsg(operation string, cause error) (err error) {
+	if e, ok := b.eloquent.(*Eloquent[T]); ok {
+		err = e.errMsg(operation, cause)
+		return
+	}
+	err = newError("", operation, cause)
+	return
+}
+
+func (b *Builder[T]) push(field string, args ...any) {
+	switch len(args) {
+	case 0:
+		b.add(bson.M{field: bson.M{"$exists": true}})
+	case 1:
+		b.add(bson.M{field: args[0]})
+	default:
+		op, ok := args[0].(string)
+		if !ok {
+			b.add(bson.M{field: args[0]})
+			return
+		}
+		if mapped, exists := operators[strings.ToLower(op)]; exists {
+			op = mapped
+		} else if !strings.HasPrefix(op, "$") {
+			if b.err == nil {
+				b.err = fmt.Errorf("%w: unknown operator %q of field %s", ErrInvalidQuery, op, field)
+			}
+			return
+		}
+		if op == "$eq" {
+			b.add(bson.M{field: args[1]})
+			return
+		}
+		b.add(bson.M{field: bson.M{op: args[1]}})
+	}
+}
+
+// flattenValues expand a single slice argument, so WhereIn(field, slice) is the same as WhereIn(field, slice...).
+// []byte is a binary value, not a slice of values
+func flattenValues(values []any) []any {
+	if len(values) != 1 {
+		return values
+	}
+	if _, ok := values[0].([]byte); ok {
+		return values
+	}
+
+	list := reflect.ValueOf(values[0])
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return values
+	}
+	flat := make([]any, 0, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		flat = append(flat, list.Index(i).Interface())
+	}
+	return flat
+}
+
+func (b *Builder[T]) add(cond bson.M) {
+	last := len(b.groups) - 1
+	b.groups[last] = append(b.groups[last], cond)
+}
+
+// sortOptions is nil if OrderBy was not called, so the default sort of paginate is kept
+func (b *Builder[T]) sortOptions() []*options.FindOptions {
+	if len(b.sort) == 0 {
+		return nil
+	}
+	return []*options.FindOptions{options.Find().SetSort(b.sort)}
+}
+
+func (b *Builder[T]) findOptions() *options.FindOptions {
+	opts := options.Find()
+	if len(b.sort) > 0 {
+		opts.SetSort(b.sort)
+	}
+	if b.limit > 0 {
+		opts.SetLimit(b.limit)
+	}
+	if b.skip > 0 {
+		opts.SetSkip(b.skip)
+	}
+	return opts
+}
@@ -0,0 +1,304 @@
+package orm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type bulkKind int
+
+const (
+	bulkInsertOne bulkKind = iota
+	bulkUpdateOne
+	bulkUpdateMany
+	bulkReplaceOne
+	bulkDeleteOne
+	bulkDeleteMany
+)
+
+type bulkOperation struct {
+	kind   bulkKind
+	filter any
+	data   any
+	upsert bool
+}
+
+// Bulk is a chainable builder of mixed write operations sent to mongodb by one BulkWrite command, create it by BulkWrite
+type Bulk[T any] struct {
+	eloquent   *Eloquent[T]
+	operations []bulkOperation
+	ordered    bool
+}
+
+// BulkResult is the result of Bulk.Execute, counts are totals of all operations.
+// with soft deletes, soft deleted documents are counted in ModifiedCount instead of DeletedCount
+type BulkResult struct {
+	InsertedCount int `json:"inserted_count"`
+	MatchedCount  int `json:"matched_count"`
+	ModifiedCount int `json:"modified_count"`
+	DeletedCount  int `json:"deleted_count"`
+	UpsertedCount int `json:"upserted_count"`
+	// operation index to _id of inserted document
+	InsertedIDs map[int]string `json:"inserted_ids"`
+	// operation index to _id of upserted document
+	UpsertedIDs map[int]string `json:"upserted_ids"`
+	// failed operations, ordered bulk stops at the first one
+	Errors []BulkError `json:"errors"`
+}
+
+// BulkError is the failure of an operation of bulk
+type BulkError struct {
+	// operation index in the order of adding
+	Index   int    `json:"index"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+/**
+ * @title start a bulk write, operations are run in the order of adding and stop at the first failure unless Ordered(false)
+ * @example result, err := userOrm.BulkWrite().InsertOne(&user).UpdateOne(id, orm.Set("age", 18)).DeleteMany(bson.M{"age": 0}).Execute(ctx)
+ */
+func (e *Eloquent[T]) BulkWrite() *Bulk[T] {
+	return &Bulk[T]{eloquent: e, ordered: true}
+}
+
+/**
+ * @title run operations in order and stop at the first failure (true, default), or run all of them in any order (false)
+ */
+func (b *Bulk[T]) Ordered(ordered bool) *Bulk[T] {
+	b.ordered = ordered
+	return b
+}
+
+func (b *Bulk[T]) add(operation bulkOperation) *Bulk[T] {
+	b.operations = append(b.operations, operation)
+	return b
+}
+
+/**
+ * @title insert a document, _id is generated if it is empty
+ */
+func (b *Bulk[T]) InsertOne(data *T) *Bulk[T] {
+	return b.add(bulkOperation{kind: bulkInsertOne, data: data})
+}
+
+/**
+ * @title update the first matched document
+ * @param idOrFilter any _id string or query condition
+ * @param data any *T, *Update or a document of fields, same as Update
+ */
+func (b *Bulk[T]) UpdateOne(idOrFilter any, data any) *Bulk[T] {
+	return b.add(bulkOperation{kind: bulkUpdateOne, filter: idOrFilter, data: data})
+}
+
+/**
+ * @title update all matched documents
+ * @param data any *T, *Update or a document of fields, same as UpdateMultiple
+ */
+func (b *Bulk[T]) UpdateMany(filter any, data any) *Bulk[T] {
+	return b.add(bulkOperation{kind: bulkUpdateMany, filter: filter, data: data})
+}
+
+/**
+ * @title update the first matched document, or insert one built from equality conditions of filter and data
+ * @param data any *T, *Update or a document of fields
+ */
+func (b *Bulk[T]) Upsert(filter any, data any) *Bulk[T] {
+	return b.add(bulkOperation{kind: bulkUpdateOne, filter: filter, data: data, upsert: true})
+}
+
+/**
+ * @title replace the first matched document, _id is kept
+ * @param upsert ...bool insert data if nothing matched. default=false
+ */
+func (b *Bulk[T]) ReplaceOne(idOrFilter any, data *T, upsert ...bool) *Bulk[T] {
+	return b.add(bulkOperation{kind: bulkReplaceOne, filter: idOrFilter, data: data, upsert: len(upsert) > 0 && upsert[0]})
+}
+
+/**
+ * @title delete the first matched document, it is soft deleted if soft deletes is enabled
+ * @param idOrFilter any _id string or query condition
+ */
+func (b *Bulk[T]) DeleteOne(idOrFilter any) *Bulk[T] {
+	return b.add(bulkOperation{kind: bulkDeleteOne, filter: idOrFilter})
+}
+
+/**
+ * @title delete all matched documents, they are soft deleted if soft deletes is enabled
+ */
+func (b *Bulk[T]) DeleteMany(filter any) *Bulk[T] {
+	return b.add(bulkOperation{kind: bulkDeleteMany, filter: filter})
+}
+
+/**
+ * @title send all operations by one BulkWrite command. BeforeInsert and BeforeUpdate hooks of models are called first,
+ * AfterInsert hook of inserted models at last. delete hooks are not called
+ * @return result *BulkResult counts, ids and errors of operations, it is returned with the error of write failures
+ * @return err error ErrDuplicateKey ... if any operation failed, or fail message from query
+ */
+func (b *Bulk[T]) Execute(ctx context.Context) (result *BulkResult, err error) {
+	e := b.eloquent
+	result = &BulkResult{InsertedIDs: map[int]string{}, UpsertedIDs: map[int]string{}, Errors: []BulkError{}}
+	if len(b.operations) == 0 {
+		return
+	}
+
+	coll, errConn := e.collection("BulkWrite")
+	if errConn != nil {
+		result = nil
+		err = errConn
+		return
+	}
+
+	models, insertedIDs, err := b.writeModels(ctx)
+	if err != nil {
+		result = nil
+		return
+	}
+
+	written, errW := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(b.ordered))
+
+	var exception mongo.BulkWriteException
+	if errW != nil && !errors.As(errW, &exception) {
+		logger.LogDebug.Error(e.logTitle, errW, getCurrentFuncInfo(1))
+		result = nil
+		err = e.errMsg("BulkWrite", errW)
+		return
+	}
+
+	failed := map[int]bool{}
+	firstFailure := len(models)
+	for _, writeErr := range exception.WriteErrors {
+		failed[writeErr.Index] = true
+		if writeErr.Index < firstFailure {
+			firstFailure = writeErr.Index
+		}
+		result.Errors = append(result.Errors, BulkError{Index: writeErr.Index, Code: writeErr.Code, Message: writeErr.Message})
+	}
+
+	if written != nil {
+		result.InsertedCount = int(written.InsertedCount)
+		result.MatchedCount = int(written.MatchedCount)
+		result.ModifiedCount = int(written.ModifiedCount)
+		result.DeletedCount = int(written.DeletedCount)
+		result.UpsertedCount = int(written.UpsertedCount)
+		for index, id := range written.UpsertedIDs {
+			result.UpsertedIDs[int(index)] = idString(id)
+		}
+	}
+
+	for index, id := range insertedIDs {
+		if failed[index] || (b.ordered && index > firstFailure) {
+			continue
+		}
+		result.InsertedIDs[index] = idString(id)
+		e.setID(b.operations[index].data.(*T), id)
+		if errH := afterInsert(ctx, b.operations[index].data); errH != nil && err == nil {
+			err = e.errMsg("BulkWrite", errH)
+		}
+	}
+
+	if errW != nil {
+		logger.LogDebug.Error(e.logTitle, errW, getCurrentFuncInfo(1))
+		err = e.errMsg("BulkWrite", errW)
+	}
+	return
+}
+
+// writeModels convert operations to write models, _id of inserted documents are generated here to report them
+func (b *Bulk[T]) writeModels(ctx context.Context) (models []mongo.WriteModel, insertedIDs map[int]any, err error) {
+	e := b.eloquent
+	insertedIDs = map[int]any{}
+
+	for index, operation := range b.operations {
+		filter := operation.filter
+		if operation.kind != bulkInsertOne && operation.kind != bulkUpdateMany && operation.kind != bulkDeleteMany {
+			if filter, err = e.idFilter("BulkWrite", filter); err != nil {
+				return
+			}
+		}
+
+		var inserting bson.M
+		if operation.upsert {
+			if inserting, err = e.insertValues(ctx, "BulkWrite", filter); err != nil {
+				return
+			}
+		}
+
+		filter = e.scope(filter)
+		if filter == nil {
+			filter = bson.M{}
+		}
+
+		var model mongo.WriteModel
+		switch operation.kind {
+		case bulkInsertOne:
+			var doc bson.D
+			var id any
+			if doc, id, err = e.insertDocument(ctx, "BulkWrite", operation.data.(*T)); err != nil {
+				return
+			}
+			insertedIDs[index] = id
+			model = mongo.NewInsertOneModel().SetDocument(doc)
+		case bulkUpdateOne, bulkUpdateMany:
+			var update any
+			if update, err = e.updateDocument(ctx, "BulkWrite", operation.data); err != nil {
+				return
+			}
+			if operation.upsert {
+				update = insertFields(update, inserting)
+			}
+			if operation.kind == bulkUpdateOne {
+				model = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(operation.upsert)
+			} else {
+				model = mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(update)
+			}
+		case bulkReplaceOne:
+			data := operation.data.(*T)
+			if errH := beforeUpdate(ctx, data); errH != nil {
+				err = e.errMsg("BulkWrite", errH)
+				return
+			}
+			if errT := e.timestamps.touch(data, false); errT != nil {
+				err = e.errMsg("BulkWrite", errT)
+				return
+			}
+			replacement, errD := modelDocument(data)
+			if errD != nil {
+				err = e.errMsg("BulkWrite", errD)
+				return
+			}
+			if operation.upsert {
+				model = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(replacePipeline(replacement, inserting)).SetUpsert(true)
+			} else {
+				model = mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(replacement)
+			}
+		case bulkDeleteOne, bulkDeleteMany:
+			model = e.deleteModel(filter, operation.kind == bulkDeleteMany)
+		}
+		models = append(models, model)
+	}
+	return
+}
+
+// deleteModel delete documents, or set deleted_at if soft deletes is enabled
+func (e *Eloquent[T]) deleteModel(filter any, many bool) mongo.WriteModel {
+	if e.softDeletes.enabled {
+		update := bson.M{"$set": bson.M{deletedAtField: e.softDeletes.deletedAt()}}
+		if many {
+			return mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(update)
+		}
+		return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
+	}
+
+	if many {
+		return mongo.NewDeleteManyModel().SetFilter(filter)
+	}
+	return mongo.NewDeleteOneModel().SetFilter(filter)
+}
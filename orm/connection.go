@@ -0,0 +1,410 @@
+package orm
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// name of the connection configured by Setup
+const DefaultConnection = "default"
+
+type connection struct {
+	config *Config
+	client *mongo.Client
+	// serialize ConnectTo of this connection, network I/O is done without holding connectionsMu
+	connecting sync.Mutex
+}
+
+var (
+	// guard connections and config, client of each connection
+	connectionsMu sync.RWMutex
+	connections   = map[string]*connection{}
+)
+
+// Config is mongodb connect config
+type Config struct {
+	// db name ex:go-eloquent-mongodb
+	DB string
+	// connection string, Host, Port and ReplicaSet are ignored if it is set. ex:mongodb://127.0.0.1:27017/?w=majority
+	URI string
+	// mongodb host ex:127.0.0.1
+	Host string
+	// mongodb port ex:27017
+	Port string
+	// mongodb user
+	User string
+	// mongodb password
+	Password string
+	// database to authenticate user. default=admin
+	AuthSource string
+	// enable tls
+	TLS bool
+	// custom tls config, TLS is enabled if it is set
+	TLSConfig *tls.Config
+	// replica set name
+	ReplicaSet string
+	// connection pool size, 0 means driver default
+	MinPoolSize uint64
+	MaxPoolSize uint64
+	// 0 means driver default
+	ConnectTimeout         time.Duration
+	ServerSelectionTimeout time.Duration
+	// app name shown in mongodb log
+	AppName string
+}
+
+// ConfigOption configure Config created by NewConfig or Setup
+type ConfigOption func(*Config)
+
+/**
+ * @title create mongodb connect config
+ * @param db string db name
+ */
+func NewConfig(db string, opts ...ConfigOption) *Config {
+	cfg := &Config{
+		DB:   db,
+		Host: "127.0.0.1",
+		Port: "27017",
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+func WithURI(uri string) ConfigOption {
+	return func(c *Config) {
+		c.URI = uri
+	}
+}
+
+func WithHost(host, port string) ConfigOption {
+	return func(c *Config) {
+		c.Host = host
+		c.Port = port
+	}
+}
+
+func WithUser(user, password string) ConfigOption {
+	return func(c *Config) {
+		c.User = user
+		c.Password = password
+	}
+}
+
+func WithAuthSource(authSource string) ConfigOption {
+	return func(c *Config) {
+		c.AuthSource = authSource
+	}
+}
+
+/**
+ * @title enable tls
+ * @param tlsConfig *tls.Config nil to use system certificate
+ */
+func WithTLS(tlsConfig *tls.Config) ConfigOption {
+	return func(c *Config) {
+		c.TLS = true
+		c.TLSConfig = tlsConfig
+	}
+}
+
+func WithReplicaSet(replicaSet string) ConfigOption {
+	return func(c *Config) {
+		c.ReplicaSet = replicaSet
+	}
+}
+
+func WithPoolSize(min, max uint64) ConfigOption {
+	return func(c *Config) {
+		c.MinPoolSize = min
+		c.MaxPoolSize = max
+	}
+}
+
+func WithTimeout(connect, serverSelection time.Duration) ConfigOption {
+	return func(c *Config) {
+		c.ConnectTimeout = connect
+		c.ServerSelectionTimeout = serverSelection
+	}
+}
+
+func WithAppName(appName string) ConfigOption {
+	return func(c *Config) {
+		c.AppName = appName
+	}
+}
+
+/**
+ * @title setup mongodb connect config of default connection, call it again to replace the config before Connect.
+ * password needs a user given by WithUser, Connect returns ErrInvalidConfig otherwise
+ *
+ * Deprecated: use SetupConfig(NewConfig(db, WithHost(host, port), WithUser(user, password))) instead.
+ */
+func Setup(db, host, port, password string, opts ...ConfigOption) {
+	cfg := NewConfig(db, WithHost(host, port))
+	cfg.Password = password
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	SetupConfig(cfg)
+}
+
+/**
+ * @title setup mongodb connect config of default connection by Config
+ */
+func SetupConfig(cfg *Config) {
+	AddConnection(DefaultConnection, cfg)
+}
+
+/**
+ * @title register a named connection, bind eloquent to it by OnConnection.
+ * replacing the config of a connected connection takes effect after Disconnect
+ * @param name string connection name ex:analytics
+ */
+func AddConnection(name string, cfg *Config) {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+
+	if current, ok := connections[name]; ok {
+		current.config = cfg
+		return
+	}
+	connections[name] = &connection{config: cfg}
+}
+
+/**
+ * @title get client of a connected connection
+ * @return client *mongo.Client nil if the connection is not connected
+ */
+func Connection(name string) *mongo.Client {
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+
+	if current, ok := connections[name]; ok {
+		return current.client
+	}
+	return nil
+}
+
+// connectionConfig get config of a registered connection
+func connectionConfig(name string) *Config {
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+
+	if current, ok := connections[name]; ok {
+		return current.config
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	if c == nil {
+		return fmt.Errorf("%w: call Setup before Connect", ErrInvalidConfig)
+	}
+	if c.URI == "" && (c.Host == "" || c.Port == "") {
+		return fmt.Errorf("%w: URI or Host and Port is required", ErrInvalidConfig)
+	}
+	if c.Password != "" && c.User == "" {
+		return fmt.Errorf("%w: password is given without user", ErrInvalidConfig)
+	}
+	return nil
+}
+
+func (c *Config) uri() string {
+	if c.URI != "" {
+		return c.URI
+	}
+	return fmt.Sprintf("mongodb://%s:%s/?retryWrites=true&w=majority", c.Host, c.Port)
+}
+
+func (c *Config) clientOptions() *options.ClientOptions {
+	opts := options.Client().ApplyURI(c.uri())
+
+	if c.User != "" {
+		opts.SetAuth(options.Credential{
+			Username:   c.User,
+			Password:   c.Password,
+			AuthSource: c.AuthSource,
+		})
+	}
+	if c.TLSConfig != nil {
+		opts.SetTLSConfig(c.TLSConfig)
+	} else if c.TLS {
+		opts.SetTLSConfig(&tls.Config{})
+	}
+	if c.ReplicaSet != "" {
+		opts.SetReplicaSet(c.ReplicaSet)
+	}
+	if c.MinPoolSize > 0 {
+		opts.SetMinPoolSize(c.MinPoolSize)
+	}
+	if c.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(c.MaxPoolSize)
+	}
+	if c.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(c.ConnectTimeout)
+	}
+	if c.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(c.ServerSelectionTimeout)
+	}
+	if c.AppName != "" {
+		opts.SetAppName(c.AppName)
+	}
+	return opts
+}
+
+/**
+ * @title connect default connection and verify it by ping
+ * @return client *mongo.Client
+ * @return err error ErrInvalidConfig if Setup was not called, or fail message from driver
+ */
+func Connect(ctx context.Context) (client *mongo.Client, err error) {
+	client, err = ConnectTo(ctx, DefaultConnection)
+	return
+}
+
+/**
+ * @title connect a named connection and verify it by ping
+ * @param name string connection name registered by AddConnection
+ * @return client *mongo.Client
+ * @return err error ErrInvalidConfig if the connection was not registered, or fail message from driver
+ */
+func ConnectTo(ctx context.Context, name string) (client *mongo.Client, err error) {
+	connectionsMu.RLock()
+	current, ok := connections[name]
+	connectionsMu.RUnlock()
+
+	if !ok {
+		errV := fmt.Errorf("%w: connection %q is not registered", ErrInvalidConfig, name)
+		logger.LogDebug.Error(`[connect fail]: `, errV, getCurrentFuncInfo(1))
+		err = newError("", "Connect", errV)
+		return
+	}
+
+	current.connecting.Lock()
+	defer current.connecting.Unlock()
+
+	connectionsMu.RLock()
+	client, cfg := current.client, current.config
+	connectionsMu.RUnlock()
+	if client != nil {
+		return
+	}
+
+	if errV := cfg.validate(); errV != nil {
+		logger.LogDebug.Error(`[connect fail]: `, errV, getCurrentFuncInfo(1))
+		err = newError("", "Connect", errV)
+		return
+	}
+
+	newClient, errC := mongo.Connect(ctx, cfg.clientOptions())
+	if errC != nil {
+		logger.LogDebug.Error(`[connect fail]: `, errC, getCurrentFuncInfo(1))
+		err = newError("", "Connect", errC)
+		return
+	}
+
+	if errP := newClient.Ping(ctx, readpref.Primary()); errP != nil {
+		logger.LogDebug.Error(`[connect fail]: `, errP, getCurrentFuncInfo(1))
+		_ = newClient.Disconnect(ctx)
+		err = newError("", "Connect", errP)
+		return
+	}
+
+	connectionsMu.Lock()
+	current.client = newClient
+	connectionsMu.Unlock()
+
+	client = newClient
+	return
+}
+
+/**
+ * @title connect every registered connection
+ */
+func ConnectAll(ctx context.Context) (err error) {
+	connectionsMu.RLock()
+	names := []string{}
+	for name := range connections {
+		names = append(names, name)
+	}
+	connectionsMu.RUnlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err = ConnectTo(ctx, name); err != nil {
+			return
+		}
+	}
+	return
+}
+
+/**
+ * @title check every registered connection is connected and reachable, for readiness probe
+ */
+func Ping(ctx context.Context) (err error) {
+	connectionsMu.RLock()
+	clients := map[string]*mongo.Client{}
+	for name, current := range connections {
+		clients[name] = current.client
+	}
+	connectionsMu.RUnlock()
+
+	if len(clients) == 0 {
+		err = newError("", "Ping", ErrNotConnected)
+		return
+	}
+
+	for name, client := range clients {
+		if client == nil {
+			err = newError("", "Ping", fmt.Errorf("%w: connection %q", ErrNotConnected, name))
+			return
+		}
+
+		if errP := client.Ping(ctx, readpref.Primary()); errP != nil {
+			err = newError("", "Ping", errP)
+			return
+		}
+	}
+	return
+}
+
+/**
+ * @title disconnect every connection
+ */
+func Disconnect(ctx context.Context) (err error) {
+	connectionsMu.RLock()
+	clients := map[*connection]*mongo.Client{}
+	for _, current := range connections {
+		if current.client != nil {
+			clients[current] = current.client
+		}
+	}
+	connectionsMu.RUnlock()
+
+	for current, client := range clients {
+		if errD := client.Disconnect(ctx); errD != nil {
+			logger.LogDebug.Error(`[disconnect fail]: `, errD, getCurrentFuncInfo(1))
+			err = newError("", "Disconnect", errD)
+			continue
+		}
+
+		connectionsMu.Lock()
+		if current.client == client {
+			current.client = nil
+		}
+		connectionsMu.Unlock()
+	}
+	return
+}
@@ -0,0 +1,214 @@
+package orm
+
+import (
+	"context"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// default document count of a batch of Each and Chunk
+const defaultChunkSize = 100
+
+// Cursor is a typed iterator over query results, only the current document is held in memory.
+// caller must call Close, or iterate it by Seq which closes it
+type Cursor[T any] struct {
+	eloquent *Eloquent[T]
+	cursor   *mongo.Cursor
+	current  *T
+	err      error
+}
+
+/**
+ * @title stream matched documents by a typed cursor instead of loading all of them.
+ * relations of With are loaded per document, use Chunk to load them in batches
+ * @param filter any query condition
+ * @param opts ...*options.FindOptions sort, projection, batch size ...
+ * @return cursor *Cursor[T] caller must close it
+ * @return err error fail message from query
+ */
+func (e *Eloquent[T]) Cursor(ctx context.Context, filter any, opts ...*options.FindOptions) (cursor *Cursor[T], err error) {
+	coll, errConn := e.collection("Cursor")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	result, errF := coll.Find(ctx, e.scope(filter), opts...)
+	if errF != nil {
+		logger.LogDebug.Error(e.logTitle, errF, getCurrentFuncInfo(1))
+		err = e.errMsg("Cursor", errF)
+		return
+	}
+
+	cursor = &Cursor[T]{eloquent: e, cursor: result}
+	return
+}
+
+/**
+ * @title move to the next document
+ * @return ok bool false when there is no more document or an error occurred, check Err
+ */
+func (c *Cursor[T]) Next(ctx context.Context) bool {
+	if c.err != nil {
+		return false
+	}
+
+	c.current = nil
+	if !c.cursor.Next(ctx) {
+		if errC := c.cursor.Err(); errC != nil {
+			logger.LogDebug.Error(c.eloquent.logTitle, errC, getCurrentFuncInfo(1))
+			c.err = c.eloquent.errMsg("Cursor", errC)
+		}
+		return false
+	}
+
+	model := new(T)
+	if errD := c.cursor.Decode(model); errD != nil {
+		logger.LogDebug.Error(c.eloquent.logTitle, errD, getCurrentFuncInfo(1))
+		c.err = c.eloquent.errMsg("Cursor", errD)
+		return false
+	}
+
+	if errH := c.eloquent.afterFind(ctx, model); errH != nil {
+		c.err = c.eloquent.errMsg("Cursor", errH)
+		return false
+	}
+
+	c.current = model
+	return true
+}
+
+/**
+ * @title get the document read by Next
+ */
+func (c *Cursor[T]) Current() *T {
+	return c.current
+}
+
+/**
+ * @title get the error stopped the iteration, nil if all documents were read
+ */
+func (c *Cursor[T]) Err() error {
+	return c.err
+}
+
+/**
+ * @title release the server cursor
+ */
+func (c *Cursor[T]) Close(ctx context.Context) error {
+	return c.cursor.Close(ctx)
+}
+
+/**
+ * @title iterate by a range function, the cursor is closed at the end or when the loop breaks.
+ * the error of iteration is yielded as the last element with a nil model
+ * @example for user, err := range cursor.Seq(ctx) {...} (go 1.23), or cursor.Seq(ctx)(func(user *User, err error) bool {...})
+ */
+func (c *Cursor[T]) Seq(ctx context.Context) func(yield func(*T, error) bool) {
+	return func(yield func(*T, error) bool) {
+		defer c.Close(ctx)
+
+		for c.Next(ctx) {
+			if !yield(c.current, nil) {
+				return
+			}
+		}
+
+		if c.err != nil {
+			yield(nil, c.err)
+		}
+	}
+}
+
+/**
+ * @title call fn with matched documents in batches of size, at most size documents are held in memory.
+ * relations of With are loaded once per batch. iteration stops at the first error of fn, which is returned as it is
+ * @param size int document count of a batch. default=100
+ * @param fn func([]*T) error
+ * @param opts ...*options.FindOptions sort, projection ...
+ * @return err error error of fn, or fail message from query
+ */
+func (e *Eloquent[T]) Chunk(ctx context.Context, filter any, size int, fn func([]*T) error, opts ...*options.FindOptions) (err error) {
+	err = e.chunk(ctx, "Chunk", filter, size, fn, opts...)
+	return
+}
+
+/**
+ * @title call fn with each matched document, documents are read in batches of 100.
+ * iteration stops at the first error of fn, which is returned as it is
+ * @param fn func(*T) error
+ * @param opts ...*options.FindOptions sort, projection ...
+ * @return err error error of fn, or fail message from query
+ */
+func (e *Eloquent[T]) Each(ctx context.Context, filter any, fn func(*T) error, opts ...*options.FindOptions) (err error) {
+	err = e.chunk(ctx, "Each", filter, defaultChunkSize, func(models []*T) error {
+		for _, model := range models {
+			if errF := fn(model); errF != nil {
+				return errF
+			}
+		}
+		return nil
+	}, opts...)
+	return
+}
+
+func (e *Eloquent[T]) chunk(ctx context.Context, operation string, filter any, size int, fn func([]*T) error, opts ...*options.FindOptions) (err error) {
+	if size < 1 {
+		size = defaultChunkSize
+	}
+
+	coll, errConn := e.collection(operation)
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	opts = append([]*options.FindOptions{options.Find().SetBatchSize(int32(size))}, opts...)
+	cursor, errF := coll.Find(ctx, e.scope(filter), opts...)
+	if errF != nil {
+		logger.LogDebug.Error(e.logTitle, errF, getCurrentFuncInfo(2))
+		err = e.errMsg(operation, errF)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	batch := make([]*T, 0, size)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if errH := e.afterFind(ctx, batch...); errH != nil {
+			return e.errMsg(operation, errH)
+		}
+		errF := fn(batch)
+		batch = make([]*T, 0, size)
+		return errF
+	}
+
+	for cursor.Next(ctx) {
+		model := new(T)
+		if errD := cursor.Decode(model); errD != nil {
+			logger.LogDebug.Error(e.logTitle, errD, getCurrentFuncInfo(2))
+			err = e.errMsg(operation, errD)
+			return
+		}
+
+		batch = append(batch, model)
+		if len(batch) == size {
+			if err = flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	if errC := cursor.Err(); errC != nil {
+		logger.LogDebug.Error(e.logTitle, errC, getCurrentFuncInfo(2))
+		err = e.errMsg(operation, errC)
+		return
+	}
+	err = flush()
+	return
+}
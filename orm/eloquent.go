@@ -2,10 +2,11 @@ package orm
 
 import (
 	"context"
+	"net/http"
+	"reflect"
 
 	"github.com/LIOU2021/go-eloquent-mongodb/logger"
 
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"gopkg.in/mgo.v2/bson"
@@ -15,40 +16,17 @@ func init() {
 	logger.Init()
 }
 
-var conf *config
-var conn *mongo.Client
-
-type config struct {
-	// db name ex:go-eloquent-mongodb
-	DB string
-	// mongodb host ex:127.0.0.1
-	Host string
-	// mongodb port ex:27017
-	Port string
-	// mongodb user
-	User string
-	// mongodb password
-	Password string
-}
-
-// setup mongodb connect config
-func Setup(db, host, port, password string) {
-	if conf != nil {
-		return
-	}
-	conf = &config{
-		DB:       db,
-		Host:     host,
-		Port:     port,
-		Password: password,
-	}
-}
-
 type Eloquent[t any] struct {
-	db         string //db name
-	Collection string
-	uri        string
-	logTitle   string
+	Collection  string
+	logTitle    string
+	settings    settings
+	timestamps  timestamps
+	softDeletes softDeletes
+	// index of the field stored as _id
+	idField []int
+	trashed trashedScope
+	// relations eager loaded by With
+	eager []string
 }
 
 type IEloquent[T any] interface {
@@ -56,65 +34,96 @@ type IEloquent[T any] interface {
 	All(ctx context.Context, opts ...*options.FindOptions) (models []*T, err error)
 	Find(ctx context.Context, id string) (model *T, err error)
 	FindMultiple(ctx context.Context, filter any, opts ...*options.FindOptions) (models []*T, err error)
+	Cursor(ctx context.Context, filter any, opts ...*options.FindOptions) (cursor *Cursor[T], err error)
+	Chunk(ctx context.Context, filter any, size int, fn func([]*T) error, opts ...*options.FindOptions) (err error)
+	Each(ctx context.Context, filter any, fn func(*T) error, opts ...*options.FindOptions) (err error)
+	BulkWrite() *Bulk[T]
 	Insert(ctx context.Context, data *T) (insertedID string, err error)
 	InsertMultiple(ctx context.Context, data []*T) (InsertedIDs []string, err error)
+	InsertMany(ctx context.Context, data []*T, opts ...*InsertOptions) (result *InsertResult, err error)
 	Delete(ctx context.Context, id string) (deleteCount int, err error)
 	DeleteMultiple(ctx context.Context, filter any) (deleteCount int, err error)
-	Update(ctx context.Context, id string, data *T) (modifiedCount int, err error)
-	UpdateMultiple(ctx context.Context, filter any, data *T) (modifiedCount int, err error)
+	Update(ctx context.Context, id string, data any) (modifiedCount int, err error)
+	UpdateMultiple(ctx context.Context, filter any, data any) (modifiedCount int, err error)
+	Increment(ctx context.Context, idOrFilter any, field string, amount ...int) (modifiedCount int, err error)
+	Decrement(ctx context.Context, idOrFilter any, field string, amount ...int) (modifiedCount int, err error)
+	Upsert(ctx context.Context, filter any, data any) (model *T, created bool, err error)
+	FirstOrCreate(ctx context.Context, filter any, defaults *T) (model *T, created bool, err error)
+	UpdateOrCreate(ctx context.Context, filter any, data *T) (model *T, created bool, err error)
+	FindAndUpdate(ctx context.Context, idOrFilter any, data any, opts ...*options.FindOneAndUpdateOptions) (model *T, err error)
+	FindAndDelete(ctx context.Context, idOrFilter any, opts ...*options.FindOneAndDeleteOptions) (model *T, err error)
+	FindAndReplace(ctx context.Context, idOrFilter any, data *T, opts ...*options.FindOneAndReplaceOptions) (model *T, err error)
 	Count(ctx context.Context, filter any) (count int, err error)
-	Paginate(ctx context.Context, limit int, page int, filter any) (paginated *Pagination[T], err error)
+	Sum(ctx context.Context, field string, filter any) (sum float64, err error)
+	Avg(ctx context.Context, field string, filter any) (avg float64, err error)
+	Min(ctx context.Context, field string, filter any) (min any, err error)
+	Max(ctx context.Context, field string, filter any) (max any, err error)
+	Distinct(ctx context.Context, field string, filter any) (values []any, err error)
+	Pluck(ctx context.Context, field string, filter any, opts ...*options.FindOptions) (values []any, err error)
+	Paginate(ctx context.Context, limit int, page int, filter any, opts ...*options.FindOptions) (paginated *Pagination[T], err error)
+	SimplePaginate(ctx context.Context, limit int, page int, filter any, opts ...*options.FindOptions) (paginated *SimplePagination[T], err error)
+	PaginateRequest(r *http.Request, filter any, opts ...*options.FindOptions) (paginated *Pagination[T], err error)
+	CursorPaginate(ctx context.Context, limit int, cursor string, filter any, sortFields ...string) (paginated *CursorPagination[T], err error)
+	Query() *Builder[T]
+	Aggregate(ctx context.Context, pipeline any, opts ...*options.AggregateOptions) (cursor *mongo.Cursor, err error)
+	EnsureIndexes(ctx context.Context) (report *IndexReport, err error)
+	WithTrashed() IEloquent[T]
+	OnlyTrashed() IEloquent[T]
+	With(relations ...string) IEloquent[T]
+	Restore(ctx context.Context, id string) (restoredCount int, err error)
+	ForceDelete(ctx context.Context, id string) (deleteCount int, err error)
 }
 
-func NewEloquent[T any](collection string) *Eloquent[T] {
+func NewEloquent[T any](collection string, opts ...Option) *Eloquent[T] {
+	s := newSettings(opts...)
+	model := reflect.TypeOf((*T)(nil)).Elem()
+	specs, errI := modelIndexes(model)
+	s.indexes = append(specs, s.indexes...)
+	s.indexErr = errI
+
 	return &Eloquent[T]{
-		db:         conf.DB,
-		Collection: collection,
-		uri:        getUri(),
-		logTitle:   getLogTitle(collection),
+		Collection:  collection,
+		logTitle:    getLogTitle(collection),
+		settings:    s,
+		timestamps:  newTimestamps(model, s.timestamps),
+		softDeletes: newSoftDeletes(model, s.softDeletes, s.timestamps.format),
+		idField:     newIDField(model),
 	}
 }
 
 /**
- * @title connect mongodb server
+ * @title get collection instance
  */
-func Connect(ctx context.Context) *mongo.Client {
-	if conn != nil {
-		return conn
-	}
-	uri := getUri()
-	if uri == "" {
-		logger.LogDebug.Fatal(`[connect fail]: `, "You must set your 'mongodb_host' and 'mongodb_port' environmental variable. See\n\t https://www.mongodb.com/docs/drivers/go/current/usage-examples/#environment-variable", getCurrentFuncInfo(1))
-	}
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
-	if err != nil {
-		logger.LogDebug.Fatal(`[connect fail]: `, err, getCurrentFuncInfo(1))
+func (e *Eloquent[T]) GetCollection() *mongo.Collection {
+	db := e.database()
+	if db == nil {
+		return nil
 	}
-	conn = client
-	return conn
+	return db.Collection(e.Collection)
 }
 
-/**
- * @title disconnect mongodb server
- */
-func Disconnect(ctx context.Context) {
-	if conn == nil {
+func (e *Eloquent[T]) collection(operation string) (coll Collection, err error) {
+	if e.settings.collection != nil {
+		coll = e.settings.collection
 		return
 	}
 
-	if err := conn.Disconnect(ctx); err != nil {
-		logger.LogDebug.Error(`[disconnect fail]: `, err, getCurrentFuncInfo(1))
+	mongoColl := e.GetCollection()
+	if mongoColl == nil {
+		logger.LogDebug.Error(e.logTitle, ErrNotConnected, getCurrentFuncInfo(2))
+		err = e.errMsg(operation, ErrNotConnected)
+		return
 	}
+	coll = mongoColl
+	return
 }
 
 /**
- * @title get collection instance
+ * @title start a chainable query builder
+ * @return builder *Builder[T]
  */
-func (e *Eloquent[T]) GetCollection() *mongo.Collection {
-	if conn == nil {
-		return nil
-	}
-	return conn.Database(e.db).Collection(e.Collection)
+func (e *Eloquent[T]) Query() *Builder[T] {
+	return newBuilder[T](e)
 }
 
 /**
@@ -123,12 +132,16 @@ func (e *Eloquent[T]) GetCollection() *mongo.Collection {
  * @return err error fail message from query
  */
 func (e *Eloquent[T]) All(ctx context.Context, opts ...*options.FindOptions) (models []*T, err error) {
-	coll := e.GetCollection()
-	cursor, errF := coll.Find(ctx, bson.M{}, opts...)
+	coll, errConn := e.collection("All")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+	cursor, errF := coll.Find(ctx, e.scope(bson.M{}), opts...)
 
 	if errF != nil {
 		logger.LogDebug.Error(e.logTitle, errF, getCurrentFuncInfo(1))
-		err = e.errMsg(errF)
+		err = e.errMsg("All", errF)
 		return
 	}
 	defer cursor.Close(ctx)
@@ -139,7 +152,7 @@ func (e *Eloquent[T]) All(ctx context.Context, opts ...*options.FindOptions) (mo
 		model := new(T)
 		if errNext := cursor.Decode(&model); errNext != nil {
 			logger.LogDebug.Error(e.logTitle, errNext, getCurrentFuncInfo(1))
-			err = e.errMsg(errNext)
+			err = e.errMsg("All", errNext)
 			return
 		}
 		models = append(models, model)
@@ -147,7 +160,12 @@ func (e *Eloquent[T]) All(ctx context.Context, opts ...*options.FindOptions) (mo
 
 	if errC := cursor.Err(); errC != nil {
 		logger.LogDebug.Error(e.logTitle, errC, getCurrentFuncInfo(1))
-		err = e.errMsg(errC)
+		err = e.errMsg("All", errC)
+		return
+	}
+
+	if errH := e.afterFind(ctx, models...); errH != nil {
+		err = e.errMsg("All", errH)
 		return
 	}
 	return
@@ -157,29 +175,39 @@ func (e *Eloquent[T]) All(ctx context.Context, opts ...*options.FindOptions) (mo
  * @title find a document by _id
  * @param id string _id of document
  * @return model struct your model struct
- * @return err error fail message from query
+ * @return err error ErrNotFound if no document, ErrInvalidID if id is not a valid _id
  */
 func (e *Eloquent[T]) Find(ctx context.Context, id string) (model *T, err error) {
-	idH, errP := primitive.ObjectIDFromHex(id)
+	idH, errP := e.parseID(id)
 	if errP != nil {
-		logger.LogDebug.Error(e.logTitle, "_id Hex fail", getCurrentFuncInfo(1))
-		err = e.errMsg(errP)
+		logger.LogDebug.Error(e.logTitle, "_id parse fail", getCurrentFuncInfo(1))
+		err = e.errInvalidID("Find", errP)
 		return
 	}
 
-	coll := e.GetCollection()
+	coll, errConn := e.collection("Find")
+	if errConn != nil {
+		err = errConn
+		return
+	}
 	model = new(T)
-	errF := coll.FindOne(ctx, bson.M{"_id": idH}).Decode(model)
+	errF := coll.FindOne(ctx, e.scope(bson.M{"_id": idH})).Decode(model)
 
 	if errF == mongo.ErrNoDocuments {
-		err = e.errMsg(errF)
+		model = nil
+		err = e.errMsg("Find", errF)
 		return
 	} else if errF != nil {
+		model = nil
 		logger.LogDebug.Error(e.logTitle, errF, getCurrentFuncInfo(1))
-		err = e.errMsg(errF)
+		err = e.errMsg("Find", errF)
 		return
 	}
 
+	if errH := e.afterFind(ctx, model); errH != nil {
+		err = e.errMsg("Find", errH)
+		return
+	}
 	return
 }
 
@@ -190,12 +218,16 @@ func (e *Eloquent[T]) Find(ctx context.Context, id string) (model *T, err error)
  * @return err error fail message from query
  */
 func (e *Eloquent[T]) FindMultiple(ctx context.Context, filter any, opts ...*options.FindOptions) (models []*T, err error) {
-	coll := e.GetCollection()
-	cursor, errF := coll.Find(ctx, filter, opts...)
+	coll, errConn := e.collection("FindMultiple")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+	cursor, errF := coll.Find(ctx, e.scope(filter), opts...)
 
 	if errF != nil {
 		logger.LogDebug.Error(e.logTitle, errF, getCurrentFuncInfo(1))
-		err = e.errMsg(errF)
+		err = e.errMsg("FindMultiple", errF)
 		return
 	}
 	defer cursor.Close(ctx)
@@ -203,57 +235,66 @@ func (e *Eloquent[T]) FindMultiple(ctx context.Context, filter any, opts ...*opt
 
 	if errA := cursor.All(ctx, &models); errA != nil {
 		logger.LogDebug.Error(e.logTitle, errA, getCurrentFuncInfo(1))
-		err = e.errMsg(errA)
+		err = e.errMsg("FindMultiple", errA)
 		return
 	}
 
+	if errH := e.afterFind(ctx, models...); errH != nil {
+		err = e.errMsg("FindMultiple", errH)
+		return
+	}
 	return
 }
 
 /**
- * @title insert a document
+ * @title insert a document, _id is generated if it is empty and written back to the _id field of data
  * @param data *T your model struct
- * @return insertedID string _id of mongodb
+ * @return insertedID string _id of mongodb, hex of ObjectID or other _id types formatted as string
  * @return err error fail message from query
  */
 func (e *Eloquent[T]) Insert(ctx context.Context, data *T) (insertedID string, err error) {
-	coll := e.GetCollection()
+	coll, errConn := e.collection("Insert")
+	if errConn != nil {
+		err = errConn
+		return
+	}
 
-	result, errI := coll.InsertOne(ctx, data)
-	if errI != nil {
-		err = e.errMsg(errI)
+	doc, id, err := e.insertDocument(ctx, "Insert", data)
+	if err != nil {
+		return
+	}
+
+	if _, errI := coll.InsertOne(ctx, doc); errI != nil {
+		err = e.errMsg("Insert", errI)
 		logger.LogDebug.Error(e.logTitle, errI, getCurrentFuncInfo(1))
 		return
 	}
-	insertedID = result.InsertedID.(primitive.ObjectID).Hex()
+	insertedID = idString(id)
+	e.setID(data, id)
+
+	if errH := afterInsert(ctx, data); errH != nil {
+		err = e.errMsg("Insert", errH)
+		return
+	}
 	return
 }
 
 /**
- * @title insert multiple document
+ * @title insert multiple document, an empty slice inserts nothing. generated _id are written back to data. use InsertMany for batch size and failures by index
  * @param data []*T{} your model slice
- * @return InsertedIDs []string _id of mongodb
+ * @return InsertedIDs []string _id of mongodb, documents inserted before the failure are included if err is not nil
  * @return err error fail message from query
  */
 func (e *Eloquent[T]) InsertMultiple(ctx context.Context, data []*T) (InsertedIDs []string, err error) {
-	coll := e.GetCollection()
-	var slice []any
-	for _, value := range data {
-		slice = append(slice, value)
-	}
-
-	result, errI := coll.InsertMany(ctx, slice)
-	if errI != nil {
-		err = e.errMsg(errI)
-		logger.LogDebug.Error(e.logTitle, errI, getCurrentFuncInfo(1))
+	result, err := e.insertMany(ctx, "InsertMultiple", data)
+	InsertedIDs = []string{}
+	if result == nil {
 		return
 	}
-
-	InsertedIDs = []string{}
-
-	for _, id := range result.InsertedIDs {
-		idString := id.(primitive.ObjectID).Hex()
-		InsertedIDs = append(InsertedIDs, idString)
+	for i := range data {
+		if id, ok := result.InsertedIDs[i]; ok {
+			InsertedIDs = append(InsertedIDs, id)
+		}
 	}
 	return
 }
@@ -265,25 +306,72 @@ func (e *Eloquent[T]) InsertMultiple(ctx context.Context, data []*T) (InsertedID
  * @return err error fail message from query
  */
 func (e *Eloquent[T]) Delete(ctx context.Context, id string) (deleteCount int, err error) {
-	idH, errP := primitive.ObjectIDFromHex(id)
+	deleteCount, err = e.delete(ctx, "Delete", id, false)
+	return
+}
+
+func (e *Eloquent[T]) delete(ctx context.Context, operation string, id string, force bool) (deleteCount int, err error) {
+	idH, errP := e.parseID(id)
 	if errP != nil {
-		logger.LogDebug.Error(e.logTitle, "_id Hex fail", getCurrentFuncInfo(1))
-		err = e.errMsg(errP)
+		logger.LogDebug.Error(e.logTitle, "_id parse fail", getCurrentFuncInfo(2))
+		err = e.errInvalidID(operation, errP)
 		return
 	}
 
-	coll := e.GetCollection()
+	coll, errConn := e.collection(operation)
+	if errConn != nil {
+		err = errConn
+		return
+	}
 
 	filter := bson.M{"_id": idH}
+	if !force {
+		filter = e.scope(filter).(bson.M)
+	}
 
-	result, errD := coll.DeleteOne(ctx, filter)
-	if errD != nil {
-		err = e.errMsg(errD)
-		logger.LogDebug.Error(e.logTitle, errD, getCurrentFuncInfo(1))
-		return
+	var model *T
+	if hasDeleteHook[T]() {
+		model = new(T)
+		errF := coll.FindOne(ctx, filter).Decode(model)
+		if errF == mongo.ErrNoDocuments {
+			return
+		} else if errF != nil {
+			logger.LogDebug.Error(e.logTitle, errF, getCurrentFuncInfo(2))
+			err = e.errMsg(operation, errF)
+			return
+		}
+
+		if errH := beforeDelete(ctx, model); errH != nil {
+			err = e.errMsg(operation, errH)
+			return
+		}
 	}
 
-	deleteCount = int(result.DeletedCount)
+	if e.softDeletes.enabled && !force {
+		update := bson.M{"$set": bson.M{deletedAtField: e.softDeletes.deletedAt()}}
+		result, errU := coll.UpdateOne(ctx, filter, update)
+		if errU != nil {
+			err = e.errMsg(operation, errU)
+			logger.LogDebug.Error(e.logTitle, errU, getCurrentFuncInfo(2))
+			return
+		}
+		deleteCount = int(result.ModifiedCount)
+	} else {
+		result, errD := coll.DeleteOne(ctx, filter)
+		if errD != nil {
+			err = e.errMsg(operation, errD)
+			logger.LogDebug.Error(e.logTitle, errD, getCurrentFuncInfo(2))
+			return
+		}
+		deleteCount = int(result.DeletedCount)
+	}
+
+	if model != nil && deleteCount > 0 {
+		if errH := afterDelete(ctx, model); errH != nil {
+			err = e.errMsg(operation, errH)
+			return
+		}
+	}
 	return
 }
 
@@ -294,68 +382,162 @@ func (e *Eloquent[T]) Delete(ctx context.Context, id string) (deleteCount int, e
  * @return err error fail message from query
  */
 func (e *Eloquent[T]) DeleteMultiple(ctx context.Context, filter any) (deleteCount int, err error) {
-	coll := e.GetCollection()
-
-	results, errD := coll.DeleteMany(ctx, filter)
-	if errD != nil {
-		err = e.errMsg(errD)
-		logger.LogDebug.Error(e.logTitle, errD, getCurrentFuncInfo(1))
+	coll, errConn := e.collection("DeleteMultiple")
+	if errConn != nil {
+		err = errConn
 		return
 	}
 
-	deleteCount = int(results.DeletedCount)
+	filter = e.scope(filter)
+
+	var models []*T
+	if hasDeleteHook[T]() {
+		// load documents for hooks, then only delete the loaded documents
+		cursor, errF := coll.Find(ctx, filter)
+		if errF != nil {
+			logger.LogDebug.Error(e.logTitle, errF, getCurrentFuncInfo(1))
+			err = e.errMsg("DeleteMultiple", errF)
+			return
+		}
+		defer cursor.Close(ctx)
+
+		ids := []any{}
+		for cursor.Next(ctx) {
+			model := new(T)
+			if errNext := cursor.Decode(model); errNext != nil {
+				logger.LogDebug.Error(e.logTitle, errNext, getCurrentFuncInfo(1))
+				err = e.errMsg("DeleteMultiple", errNext)
+				return
+			}
+			if errH := beforeDelete(ctx, model); errH != nil {
+				err = e.errMsg("DeleteMultiple", errH)
+				return
+			}
+			ids = append(ids, cursor.Current.Lookup("_id"))
+			models = append(models, model)
+		}
+
+		if errC := cursor.Err(); errC != nil {
+			logger.LogDebug.Error(e.logTitle, errC, getCurrentFuncInfo(1))
+			err = e.errMsg("DeleteMultiple", errC)
+			return
+		}
+
+		if len(ids) == 0 {
+			return
+		}
+		filter = bson.M{"_id": bson.M{"$in": ids}}
+	}
+
+	if e.softDeletes.enabled {
+		update := bson.M{"$set": bson.M{deletedAtField: e.softDeletes.deletedAt()}}
+		results, errU := coll.UpdateMany(ctx, filter, update)
+		if errU != nil {
+			err = e.errMsg("DeleteMultiple", errU)
+			logger.LogDebug.Error(e.logTitle, errU, getCurrentFuncInfo(1))
+			return
+		}
+		deleteCount = int(results.ModifiedCount)
+	} else {
+		results, errD := coll.DeleteMany(ctx, filter)
+		if errD != nil {
+			err = e.errMsg("DeleteMultiple", errD)
+			logger.LogDebug.Error(e.logTitle, errD, getCurrentFuncInfo(1))
+			return
+		}
+		deleteCount = int(results.DeletedCount)
+	}
+
+	for _, model := range models {
+		if errH := afterDelete(ctx, model); errH != nil {
+			err = e.errMsg("DeleteMultiple", errH)
+			return
+		}
+	}
 	return
 }
 
 /**
  * @title update a document
  * @param id string _id of mongodb
+ * @param data any *T to set its non-empty fields, *Update for other operators, ex: orm.Set("age", 18).Push("tags", "x"), or a document of fields
  * @return modifiedCount int modified document count
  * @return err error fail message from query
  */
-func (e *Eloquent[T]) Update(ctx context.Context, id string, data *T) (modifiedCount int, err error) {
-	idH, errP := primitive.ObjectIDFromHex(id)
+func (e *Eloquent[T]) Update(ctx context.Context, id string, data any) (modifiedCount int, err error) {
+	idH, errP := e.parseID(id)
 	if errP != nil {
-		logger.LogDebug.Error(e.logTitle, "_id Hex fail", getCurrentFuncInfo(1))
-		err = e.errMsg(errP)
+		logger.LogDebug.Error(e.logTitle, "_id parse fail", getCurrentFuncInfo(1))
+		err = e.errInvalidID("Update", errP)
 		return
 	}
 
-	coll := e.GetCollection()
+	coll, errConn := e.collection("Update")
+	if errConn != nil {
+		err = errConn
+		return
+	}
 
-	filter := bson.M{"_id": idH}
-	update := bson.M{"$set": data}
+	update, err := e.updateDocument(ctx, "Update", data)
+	if err != nil {
+		return
+	}
+	filter := e.scope(bson.M{"_id": idH})
 
 	result, errU := coll.UpdateOne(ctx, filter, update)
 
 	if errU != nil {
 		logger.LogDebug.Error(e.logTitle, errU, getCurrentFuncInfo(1))
-		err = e.errMsg(errU)
+		err = e.errMsg("Update", errU)
 		return
 	}
 
 	modifiedCount = int(result.ModifiedCount)
+
+	if errH := afterUpdate(ctx, data); errH != nil {
+		err = e.errMsg("Update", errH)
+		return
+	}
 	return
 }
 
 /**
  * @title update multiple document
  * @param filter any ex:struct, bson
+ * @param data any *T to set its non-empty fields, *Update for other operators, or a document of fields
  * @return modifiedCount int modified document count
  * @return err error fail message from query
  */
-func (e *Eloquent[T]) UpdateMultiple(ctx context.Context, filter any, data *T) (modifiedCount int, err error) {
-	coll := e.GetCollection()
-	update := bson.M{"$set": data}
+func (e *Eloquent[T]) UpdateMultiple(ctx context.Context, filter any, data any) (modifiedCount int, err error) {
+	modifiedCount, err = e.updateMany(ctx, "UpdateMultiple", filter, data)
+	return
+}
 
-	result, errU := coll.UpdateMany(ctx, filter, update)
+func (e *Eloquent[T]) updateMany(ctx context.Context, operation string, filter any, data any) (modifiedCount int, err error) {
+	coll, errConn := e.collection(operation)
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	update, err := e.updateDocument(ctx, operation, data)
+	if err != nil {
+		return
+	}
+
+	result, errU := coll.UpdateMany(ctx, e.scope(filter), update)
 	if errU != nil {
-		logger.LogDebug.Error(e.logTitle, errU, getCurrentFuncInfo(1))
-		err = e.errMsg(errU)
+		logger.LogDebug.Error(e.logTitle, errU, getCurrentFuncInfo(2))
+		err = e.errMsg(operation, errU)
 		return
 	}
 
 	modifiedCount = int(result.ModifiedCount)
+
+	if errH := afterUpdate(ctx, data); errH != nil {
+		err = e.errMsg(operation, errH)
+		return
+	}
 	return
 }
 
@@ -366,12 +548,23 @@ func (e *Eloquent[T]) UpdateMultiple(ctx context.Context, filter any, data *T) (
  * @return err error fail message from query
  */
 func (e *Eloquent[T]) Count(ctx context.Context, filter any) (count int, err error) {
-	coll := e.GetCollection()
+	coll, errConn := e.collection("Count")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	filter = e.scope(filter)
+
+	// estimatedDocumentCount is not allowed in transaction
+	if filter == nil && InTransaction(ctx) {
+		filter = bson.M{}
+	}
 
 	if filter == nil {
-		estCount, estCountErr := coll.EstimatedDocumentCount(context.TODO())
+		estCount, estCountErr := coll.EstimatedDocumentCount(ctx)
 		if estCountErr != nil {
-			err = e.errMsg(estCountErr)
+			err = e.errMsg("Count", estCountErr)
 			logger.LogDebug.Error(e.logTitle, estCountErr, getCurrentFuncInfo(1))
 			return
 		}
@@ -380,7 +573,7 @@ func (e *Eloquent[T]) Count(ctx context.Context, filter any) (count int, err err
 	} else {
 		countD, errD := coll.CountDocuments(ctx, filter)
 		if errD != nil {
-			err = e.errMsg(errD)
+			err = e.errMsg("Count", errD)
 			logger.LogDebug.Error(e.logTitle, errD, getCurrentFuncInfo(1))
 			return
 		}
@@ -397,16 +590,14 @@ func (e *Eloquent[T]) Count(ctx context.Context, filter any) (count int, err err
  * @param limit int how many data display in each page. default=10
  * @param page int choose page for pagination. default=1
  * @param filter any you can use struct, bson,etc ... . but reject pass nil to filter
+ * @param opts ...*options.FindOptions sort, projection or collation. default sort is created_at desc, or _id desc if model has no created_at
  * @return pagination *pagination[T]
  * @return err error fail message from query
  */
-func (e *Eloquent[T]) Paginate(ctx context.Context, limit int, page int, filter any) (paginated *Pagination[T], err error) {
-	coll := e.GetCollection()
-
+func (e *Eloquent[T]) Paginate(ctx context.Context, limit int, page int, filter any, opts ...*options.FindOptions) (paginated *Pagination[T], err error) {
 	total, totalErr := e.Count(ctx, filter)
 	if totalErr != nil {
-		err = e.errMsg(totalErr)
-		logger.LogDebug.Error(e.logTitle, totalErr, getCurrentFuncInfo(1))
+		err = totalErr
 		return
 	}
 
@@ -427,52 +618,105 @@ func (e *Eloquent[T]) Paginate(ctx context.Context, limit int, page int, filter
 		lastPage++
 	}
 
-	if total > 0 {
+	if page <= lastPage {
 		from = limit*(page-1) + 1
 		if page == lastPage {
 			to = total
 		} else {
 			to = limit * page
 		}
-	} else {
-		from = 0
-		to = 0
 	}
 
 	defer func() {
 		paginated = newPagination(total, limit, page, lastPage, from, to, data)
 	}()
 
-	if total == 0 {
+	if page > lastPage {
 		return
 	}
 
-	findOptions := options.Find()
-	findOptions.SetSort(bson.M{"created_at": -1})
-	findOptions.SetLimit(int64(limit))
-	findOptions.SetSkip(int64(limit * (page - 1)))
+	data, err = e.findPage(ctx, "Paginate", filter, int64(limit), int64(limit*(page-1)), opts...)
+	return
+}
 
-	cursor, errF := coll.Find(ctx, filter, findOptions)
+/**
+ * @title paginate without counting documents, only report whether a next page exists
+ * @param opts ...*options.FindOptions sort, projection or collation. default sort is created_at desc, or _id desc if model has no created_at
+ */
+func (e *Eloquent[T]) SimplePaginate(ctx context.Context, limit int, page int, filter any, opts ...*options.FindOptions) (paginated *SimplePagination[T], err error) {
+	if limit < 1 {
+		limit = 10
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	data, errF := e.findPage(ctx, "SimplePaginate", filter, int64(limit+1), int64(limit*(page-1)), opts...)
 	if errF != nil {
-		logger.LogDebug.Error(e.logTitle, errF, getCurrentFuncInfo(1))
-		err = e.errMsg(errF)
+		err = errF
+		return
+	}
+
+	hasMore := len(data) > limit
+	if hasMore {
+		data = data[:limit]
+	}
+
+	var from, to int
+	if len(data) > 0 {
+		from = limit*(page-1) + 1
+		to = from + len(data) - 1
+	}
+
+	paginated = newSimplePagination(limit, page, from, to, hasMore, data)
+	return
+}
+
+// findPage find documents of a page, opts override the default sort
+func (e *Eloquent[T]) findPage(ctx context.Context, operation string, filter any, limit int64, skip int64, opts ...*options.FindOptions) (data []*T, err error) {
+	coll, errConn := e.collection(operation)
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	sortField := "_id"
+	if e.timestamps.createdAt != nil {
+		sortField = e.settings.timestamps.createdAt
+	}
+
+	findOptions := []*options.FindOptions{options.Find().SetSort(bson.M{sortField: -1})}
+	findOptions = append(findOptions, opts...)
+	findOptions = append(findOptions, options.Find().SetLimit(limit).SetSkip(skip))
+
+	cursor, errF := coll.Find(ctx, e.scope(filter), findOptions...)
+	if errF != nil {
+		logger.LogDebug.Error(e.logTitle, errF, getCurrentFuncInfo(2))
+		err = e.errMsg(operation, errF)
 		return
 	}
 	defer cursor.Close(ctx)
 
+	data = []*T{}
 	for cursor.Next(ctx) {
 		model := new(T)
-		if errNext := cursor.Decode(&model); err != nil {
-			logger.LogDebug.Error(e.logTitle, errNext, getCurrentFuncInfo(1))
-			err = e.errMsg(errNext)
+		if errNext := cursor.Decode(&model); errNext != nil {
+			logger.LogDebug.Error(e.logTitle, errNext, getCurrentFuncInfo(2))
+			err = e.errMsg(operation, errNext)
 			return
 		}
 		data = append(data, model)
 	}
 
-	if errC := cursor.Err(); err != nil {
-		logger.LogDebug.Error(e.logTitle, errC, getCurrentFuncInfo(1))
-		err = e.errMsg(errC)
+	if errC := cursor.Err(); errC != nil {
+		logger.LogDebug.Error(e.logTitle, errC, getCurrentFuncInfo(2))
+		err = e.errMsg(operation, errC)
+		return
+	}
+
+	if errH := e.afterFind(ctx, data...); errH != nil {
+		err = e.errMsg(operation, errH)
 		return
 	}
 	return
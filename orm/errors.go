@@ -0,0 +1,99 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// sentinel errors, compare them with errors.Is
+var (
+	ErrNotFound      = errors.New("orm: document not found")
+	ErrInvalidID     = errors.New("orm: invalid id")
+	ErrDuplicateKey  = errors.New("orm: duplicate key")
+	ErrNotConnected  = errors.New("orm: not connected")
+	ErrWriteConflict = errors.New("orm: write conflict")
+	ErrInvalidConfig = errors.New("orm: invalid config")
+	ErrInvalidCursor = errors.New("orm: invalid cursor")
+	ErrInvalidQuery  = errors.New("orm: invalid query")
+)
+
+// mongodb server error code of WriteConflict
+const writeConflictCode = 112
+
+// Error is returned by every eloquent method.
+// errors.Is(err, ErrNotFound) matches by Kind, errors.Is(err, mongo.ErrNoDocuments) matches the wrapped cause
+type Error struct {
+	// collection name ex:users
+	Collection string
+	// eloquent method name ex:Find
+	Operation string
+	// one of the sentinel errors, nil when the cause is not classified
+	Kind error
+	// original error from driver
+	Err error
+}
+
+func (e *Error) Error() string {
+	title := e.Operation
+	if e.Collection != "" {
+		title = fmt.Sprintf("%s.%s", e.Collection, e.Operation)
+	}
+
+	if e.Kind == nil || errors.Is(e.Err, e.Kind) {
+		return fmt.Sprintf("orm: %s: %s", title, strings.TrimPrefix(fmt.Sprint(e.Err), "orm: "))
+	}
+
+	kind := strings.TrimPrefix(e.Kind.Error(), "orm: ")
+	return fmt.Sprintf("orm: %s: %s: %v", title, kind, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+func newError(collection string, operation string, cause error) *Error {
+	return &Error{
+		Collection: collection,
+		Operation:  operation,
+		Kind:       errKind(cause),
+		Err:        cause,
+	}
+}
+
+// errKind classify driver error to sentinel error
+func errKind(err error) error {
+	var sentinel error
+	var serverErr mongo.ServerError
+
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound), errors.Is(err, mongo.ErrNoDocuments):
+		sentinel = ErrNotFound
+	case errors.Is(err, ErrInvalidID), errors.Is(err, primitive.ErrInvalidHex):
+		sentinel = ErrInvalidID
+	case errors.Is(err, ErrNotConnected), errors.Is(err, mongo.ErrClientDisconnected):
+		sentinel = ErrNotConnected
+	case errors.Is(err, ErrDuplicateKey), mongo.IsDuplicateKeyError(err):
+		sentinel = ErrDuplicateKey
+	case errors.Is(err, ErrWriteConflict):
+		sentinel = ErrWriteConflict
+	case errors.Is(err, ErrInvalidConfig):
+		sentinel = ErrInvalidConfig
+	case errors.Is(err, ErrInvalidCursor):
+		sentinel = ErrInvalidCursor
+	case errors.Is(err, ErrInvalidQuery):
+		sentinel = ErrInvalidQuery
+	case errors.As(err, &serverErr) && serverErr.HasErrorCode(writeConflictCode):
+		sentinel = ErrWriteConflict
+	}
+
+	return sentinel
+}
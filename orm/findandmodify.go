@@ -0,0 +1,216 @@
+package orm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// idFilter convert an _id string to filter by the id strategy, other value is used as filter
+func (e *Eloquent[T]) idFilter(operation string, idOrFilter any) (filter any, err error) {
+	id, ok := idOrFilter.(string)
+	if !ok {
+		filter = idOrFilter
+		return
+	}
+
+	idH, errP := e.parseID(id)
+	if errP != nil {
+		logger.LogDebug.Error(e.logTitle, "_id parse fail", getCurrentFuncInfo(2))
+		err = e.errInvalidID(operation, errP)
+		return
+	}
+	filter = bson.M{"_id": idH}
+	return
+}
+
+// decodeResult decode the document of a find and modify command
+func (e *Eloquent[T]) decodeResult(operation string, result *mongo.SingleResult) (model *T, err error) {
+	model = new(T)
+	errD := result.Decode(model)
+	if errD == nil {
+		return
+	}
+
+	model = nil
+	if !errors.Is(errD, mongo.ErrNoDocuments) {
+		logger.LogDebug.Error(e.logTitle, errD, getCurrentFuncInfo(2))
+	}
+	err = e.errMsg(operation, errD)
+	return
+}
+
+/**
+ * @title update the first matched document atomically and get it. BeforeUpdate hook of data and AfterUpdate hook of the result are called
+ * @param idOrFilter any _id string or query condition, ex: bson.M{"status": "pending"}
+ * @param data any *T to set its non-empty fields, *Update for other operators, or a document of fields
+ * @param opts ...*options.FindOneAndUpdateOptions sort, projection, upsert ... ReturnDocument is options.After by default
+ * @return model *T document after the change, or before it if options.Before is set
+ * @return err error ErrNotFound if no document matched, ErrInvalidID if id is not a valid _id
+ */
+func (e *Eloquent[T]) FindAndUpdate(ctx context.Context, idOrFilter any, data any, opts ...*options.FindOneAndUpdateOptions) (model *T, err error) {
+	filter, err := e.idFilter("FindAndUpdate", idOrFilter)
+	if err != nil {
+		return
+	}
+
+	coll, errConn := e.collection("FindAndUpdate")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	update, err := e.updateDocument(ctx, "FindAndUpdate", data)
+	if err != nil {
+		return
+	}
+
+	opts = append([]*options.FindOneAndUpdateOptions{options.FindOneAndUpdate().SetReturnDocument(options.After)}, opts...)
+	if opt := options.MergeFindOneAndUpdateOptions(opts...); opt.Upsert != nil && *opt.Upsert {
+		inserting, errV := e.insertValues(ctx, "FindAndUpdate", filter)
+		if errV != nil {
+			err = errV
+			return
+		}
+		update = insertFields(update, inserting)
+	}
+
+	result := coll.FindOneAndUpdate(ctx, e.scope(filter), update, opts...)
+	if model, err = e.decodeResult("FindAndUpdate", result); err != nil {
+		return
+	}
+
+	if errH := afterUpdate(ctx, model); errH != nil {
+		err = e.errMsg("FindAndUpdate", errH)
+		return
+	}
+	return
+}
+
+/**
+ * @title delete the first matched document atomically and get it, it is soft deleted if soft deletes is enabled.
+ * AfterDelete hook of the result is called, BeforeDelete hook is not because the document is unknown before the command
+ * @param idOrFilter any _id string or query condition, ex: bson.M{"status": "done"}
+ * @param opts ...*options.FindOneAndDeleteOptions sort, projection ...
+ * @return model *T deleted document, deleted_at is filled if soft deleted
+ * @return err error ErrNotFound if no document matched, ErrInvalidID if id is not a valid _id
+ */
+func (e *Eloquent[T]) FindAndDelete(ctx context.Context, idOrFilter any, opts ...*options.FindOneAndDeleteOptions) (model *T, err error) {
+	filter, err := e.idFilter("FindAndDelete", idOrFilter)
+	if err != nil {
+		return
+	}
+
+	coll, errConn := e.collection("FindAndDelete")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	var result *mongo.SingleResult
+	if e.softDeletes.enabled {
+		opt := options.MergeFindOneAndDeleteOptions(opts...)
+		updateOpt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if opt.Sort != nil {
+			updateOpt.SetSort(opt.Sort)
+		}
+		if opt.Projection != nil {
+			updateOpt.SetProjection(opt.Projection)
+		}
+
+		update := bson.M{"$set": bson.M{deletedAtField: e.softDeletes.deletedAt()}}
+		result = coll.FindOneAndUpdate(ctx, e.scope(filter), update, updateOpt)
+	} else {
+		result = coll.FindOneAndDelete(ctx, e.scope(filter), opts...)
+	}
+
+	if model, err = e.decodeResult("FindAndDelete", result); err != nil {
+		return
+	}
+
+	if errH := afterDelete(ctx, model); errH != nil {
+		err = e.errMsg("FindAndDelete", errH)
+		return
+	}
+	return
+}
+
+/**
+ * @title replace the first matched document atomically and get it, _id is kept. fields missing in data are removed,
+ * so carry CreatedAt of the found model to keep it, with upsert created_at is kept or set on insert.
+ * BeforeUpdate hook of data and AfterUpdate hook of the result are called
+ * @param idOrFilter any _id string or query condition
+ * @param data *T the new document
+ * @param opts ...*options.FindOneAndReplaceOptions sort, projection, upsert ... ReturnDocument is options.After by default
+ * @return model *T document after the change, or before it if options.Before is set
+ * @return err error ErrNotFound if no document matched, ErrInvalidID if id is not a valid _id
+ */
+func (e *Eloquent[T]) FindAndReplace(ctx context.Context, idOrFilter any, data *T, opts ...*options.FindOneAndReplaceOptions) (model *T, err error) {
+	filter, err := e.idFilter("FindAndReplace", idOrFilter)
+	if err != nil {
+		return
+	}
+
+	coll, errConn := e.collection("FindAndReplace")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	if errH := beforeUpdate(ctx, data); errH != nil {
+		err = e.errMsg("FindAndReplace", errH)
+		return
+	}
+	if errT := e.timestamps.touch(data, false); errT != nil {
+		err = e.errMsg("FindAndReplace", errT)
+		return
+	}
+	replacement, errD := modelDocument(data)
+	if errD != nil {
+		err = e.errMsg("FindAndReplace", errD)
+		return
+	}
+
+	opts = append([]*options.FindOneAndReplaceOptions{options.FindOneAndReplace().SetReturnDocument(options.After)}, opts...)
+	var result *mongo.SingleResult
+	if opt := options.MergeFindOneAndReplaceOptions(opts...); opt.Upsert != nil && *opt.Upsert {
+		inserting, errV := e.insertValues(ctx, "FindAndReplace", filter)
+		if errV != nil {
+			err = errV
+			return
+		}
+		result = coll.FindOneAndUpdate(ctx, e.scope(filter), replacePipeline(replacement, inserting), replaceUpdateOptions(opt))
+	} else {
+		result = coll.FindOneAndReplace(ctx, e.scope(filter), replacement, opts...)
+	}
+	if model, err = e.decodeResult("FindAndReplace", result); err != nil {
+		return
+	}
+
+	if errH := afterUpdate(ctx, model); errH != nil {
+		err = e.errMsg("FindAndReplace", errH)
+		return
+	}
+	return
+}
+
+// replaceUpdateOptions convert options of FindOneAndReplace to the update pipeline replacing the document
+func replaceUpdateOptions(opt *options.FindOneAndReplaceOptions) *options.FindOneAndUpdateOptions {
+	return &options.FindOneAndUpdateOptions{
+		BypassDocumentValidation: opt.BypassDocumentValidation,
+		Collation:                opt.Collation,
+		Comment:                  opt.Comment,
+		MaxTime:                  opt.MaxTime,
+		Projection:               opt.Projection,
+		ReturnDocument:           opt.ReturnDocument,
+		Sort:                     opt.Sort,
+		Upsert:                   opt.Upsert,
+		Hint:                     opt.Hint,
+		Let:                      opt.Let,
+	}
+}
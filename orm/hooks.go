@@ -0,0 +1,99 @@
+package orm
+
+import (
+	"context"
+)
+
+// model lifecycle hooks, implement them on the pointer of your model.
+// returning an error from a Before hook aborts the operation, the error is wrapped in *Error
+
+type BeforeInserter interface {
+	BeforeInsert(ctx context.Context) error
+}
+
+type AfterInserter interface {
+	AfterInsert(ctx context.Context) error
+}
+
+type BeforeUpdater interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+type AfterUpdater interface {
+	AfterUpdate(ctx context.Context) error
+}
+
+// BeforeDeleter is called with the document loaded before it is deleted
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// AfterDeleter is called with the document loaded before it was deleted
+type AfterDeleter interface {
+	AfterDelete(ctx context.Context) error
+}
+
+type AfterFinder interface {
+	AfterFind(ctx context.Context) error
+}
+
+func beforeInsert(ctx context.Context, model any) error {
+	if hook, ok := model.(BeforeInserter); ok {
+		return hook.BeforeInsert(ctx)
+	}
+	return nil
+}
+
+func afterInsert(ctx context.Context, model any) error {
+	if hook, ok := model.(AfterInserter); ok {
+		return hook.AfterInsert(ctx)
+	}
+	return nil
+}
+
+func beforeUpdate(ctx context.Context, model any) error {
+	if hook, ok := model.(BeforeUpdater); ok {
+		return hook.BeforeUpdate(ctx)
+	}
+	return nil
+}
+
+func afterUpdate(ctx context.Context, model any) error {
+	if hook, ok := model.(AfterUpdater); ok {
+		return hook.AfterUpdate(ctx)
+	}
+	return nil
+}
+
+func beforeDelete(ctx context.Context, model any) error {
+	if hook, ok := model.(BeforeDeleter); ok {
+		return hook.BeforeDelete(ctx)
+	}
+	return nil
+}
+
+func afterDelete(ctx context.Context, model any) error {
+	if hook, ok := model.(AfterDeleter); ok {
+		return hook.AfterDelete(ctx)
+	}
+	return nil
+}
+
+func afterFind[T any](ctx context.Context, models ...*T) error {
+	for _, model := range models {
+		if hook, ok := any(model).(AfterFinder); ok {
+			if err := hook.AfterFind(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasDeleteHook report whether documents must be loaded before delete
+func hasDeleteHook[T any]() bool {
+	model := any(new(T))
+	_, before := model.(BeforeDeleter)
+	_, after := model.(AfterDeleter)
+	return before || after
+}
@@ -0,0 +1,123 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newIDField find the field stored as _id, nil if model has none
+func newIDField(model reflect.Type) []int {
+	if model.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := 0; i < model.NumField(); i++ {
+		if bsonFieldName(model.Field(i)) == "_id" {
+			return []int{i}
+		}
+	}
+	return nil
+}
+
+/**
+ * @title write _id of inserted document back to the _id field of model if it is empty.
+ * string field gets the hex of ObjectID, other types get the id if it is convertible
+ */
+func (e *Eloquent[T]) setID(model *T, id any) {
+	if e.idField == nil || model == nil {
+		return
+	}
+
+	field := reflect.ValueOf(model).Elem().FieldByIndex(e.idField)
+	if !field.CanSet() || !field.IsZero() {
+		return
+	}
+
+	if field.Kind() == reflect.Pointer {
+		ptr := reflect.New(field.Type().Elem())
+		if !assignID(ptr.Elem(), id) {
+			return
+		}
+		field.Set(ptr)
+		return
+	}
+
+	assignID(field, id)
+}
+
+func assignID(field reflect.Value, id any) bool {
+	if raw, ok := id.(bson.RawValue); ok {
+		var decoded any
+		if err := raw.Unmarshal(&decoded); err != nil {
+			return false
+		}
+		id = decoded
+	}
+
+	if _, ok := field.Interface().(primitive.ObjectID); ok {
+		if hex, isString := id.(string); isString {
+			objectID, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				return false
+			}
+			id = objectID
+		}
+	}
+
+	value := reflect.ValueOf(id)
+	switch {
+	case !value.IsValid():
+		return false
+	case value.Type().AssignableTo(field.Type()):
+		field.Set(value)
+	case field.Kind() == reflect.String:
+		field.SetString(idString(id))
+	case value.Type().ConvertibleTo(field.Type()) && value.Kind() != reflect.String:
+		field.Set(value.Convert(field.Type()))
+	default:
+		return false
+	}
+	return true
+}
+
+// idString format _id for result, ObjectID as hex
+func idString(id any) string {
+	switch value := id.(type) {
+	case primitive.ObjectID:
+		return value.Hex()
+	case string:
+		return value
+	case bson.RawValue:
+		var decoded any
+		if err := value.Unmarshal(&decoded); err == nil {
+			return idString(decoded)
+		}
+		return value.String()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// modelDocument encode model without _id, _id of a document can not be changed by $set or replacement
+func modelDocument(data any) (doc bson.D, err error) {
+	raw, err := bson.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	var fields bson.D
+	if err = bson.Unmarshal(raw, &fields); err != nil {
+		return
+	}
+
+	doc = bson.D{}
+	for _, field := range fields {
+		if field.Key != "_id" {
+			doc = append(doc, field)
+		}
+	}
+	return
+}
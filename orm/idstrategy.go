@@ -0,0 +1,308 @@
+package orm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CountersCollection is the default collection storing sequences of SequenceStrategy
+const CountersCollection = "counters"
+
+// IDStrategy generate _id of new documents and parse _id strings of Find, Update, Delete ...
+type IDStrategy interface {
+	// Generate a new _id for a document of collection, counters is the collection of sequences, nil if not connected
+	Generate(ctx context.Context, collection string, counters Collection) (id any, err error)
+	// Parse convert an _id string to the stored value
+	Parse(id string) (value any, err error)
+}
+
+/**
+ * @title generate and parse _id by strategy instead of ObjectID
+ * @param strategy IDStrategy ex: orm.UUIDv7Strategy(), orm.SequenceStrategy()
+ */
+func WithIDStrategy(strategy IDStrategy) Option {
+	return func(s *settings) {
+		s.idStrategy = strategy
+	}
+}
+
+/**
+ * @title store sequences of SequenceStrategy in coll instead of the counters collection of connection
+ */
+func WithCounters(coll Collection) Option {
+	return func(s *settings) {
+		s.counters = coll
+	}
+}
+
+type objectIDStrategy struct{}
+
+/**
+ * @title ObjectID _id, parsed from hex. default strategy
+ */
+func ObjectIDStrategy() IDStrategy {
+	return objectIDStrategy{}
+}
+
+func (objectIDStrategy) Generate(ctx context.Context, collection string, counters Collection) (id any, err error) {
+	id = primitive.NewObjectID()
+	return
+}
+
+func (objectIDStrategy) Parse(id string) (value any, err error) {
+	value, err = primitive.ObjectIDFromHex(id)
+	return
+}
+
+type stringStrategy struct{}
+
+/**
+ * @title string _id used as it is, new documents get the hex of an ObjectID
+ */
+func StringStrategy() IDStrategy {
+	return stringStrategy{}
+}
+
+func (stringStrategy) Generate(ctx context.Context, collection string, counters Collection) (id any, err error) {
+	id = primitive.NewObjectID().Hex()
+	return
+}
+
+func (stringStrategy) Parse(id string) (value any, err error) {
+	if id == "" {
+		err = fmt.Errorf("empty id")
+		return
+	}
+	value = id
+	return
+}
+
+type uuidStrategy struct {
+	version int
+	clock   *monotonic
+}
+
+/**
+ * @title random UUID string _id, ex: 0b9c4f4e-7d0a-4c5e-9a57-2b0f5e2f3c11. any UUID version is accepted by Parse
+ */
+func UUIDv4Strategy() IDStrategy {
+	return uuidStrategy{version: 4}
+}
+
+/**
+ * @title time ordered UUID string _id, new documents are sorted by creation. any UUID version is accepted by Parse
+ */
+func UUIDv7Strategy() IDStrategy {
+	return uuidStrategy{version: 7, clock: &monotonic{bits: 74}}
+}
+
+func (s uuidStrategy) Generate(ctx context.Context, collection string, counters Collection) (id any, err error) {
+	var b [16]byte
+	if s.version == 7 {
+		ms, hi, lo, errR := s.clock.next()
+		if errR != nil {
+			err = errR
+			return
+		}
+		putMillis(b[:6], ms)
+		// 12 bits rand_a and 62 bits rand_b
+		randA := hi<<2 | lo>>62
+		b[6], b[7] = byte(randA>>8), byte(randA)
+		binary.BigEndian.PutUint64(b[8:], lo&(1<<62-1))
+	} else if _, err = rand.Read(b[:]); err != nil {
+		return
+	}
+	b[6] = b[6]&0x0f | byte(s.version)<<4
+	b[8] = b[8]&0x3f | 0x80
+
+	id = fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	return
+}
+
+func (uuidStrategy) Parse(id string) (value any, err error) {
+	if len(id) != 36 || id[8] != '-' || id[13] != '-' || id[18] != '-' || id[23] != '-' {
+		err = fmt.Errorf("invalid uuid %q", id)
+		return
+	}
+	if _, errH := hex.DecodeString(strings.ReplaceAll(id, "-", "")); errH != nil {
+		err = fmt.Errorf("invalid uuid %q", id)
+		return
+	}
+	value = strings.ToLower(id)
+	return
+}
+
+// crockford base32 alphabet of ULID
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type ulidStrategy struct {
+	clock *monotonic
+}
+
+/**
+ * @title ULID string _id, 26 characters sorted by creation time, ex: 01HGW2N7ZQ4Y5X3J8K9M0P1R2S
+ */
+func ULIDStrategy() IDStrategy {
+	return ulidStrategy{clock: &monotonic{bits: 80}}
+}
+
+func (s ulidStrategy) Generate(ctx context.Context, collection string, counters Collection) (id any, err error) {
+	ms, hi, lo, err := s.clock.next()
+	if err != nil {
+		return
+	}
+
+	var b [16]byte
+	putMillis(b[:6], ms)
+	binary.BigEndian.PutUint16(b[6:8], uint16(hi))
+	binary.BigEndian.PutUint64(b[8:], lo)
+
+	high := binary.BigEndian.Uint64(b[:8])
+	low := binary.BigEndian.Uint64(b[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[low&31]
+		low = low>>5 | high<<59
+		high >>= 5
+	}
+	id = string(out)
+	return
+}
+
+func (ulidStrategy) Parse(id string) (value any, err error) {
+	id = strings.ToUpper(id)
+	if len(id) != 26 || id[0] > '7' || strings.Trim(id, crockford) != "" {
+		err = fmt.Errorf("invalid ulid %q", id)
+		return
+	}
+	value = id
+	return
+}
+
+type sequenceStrategy struct{}
+
+/**
+ * @title auto increment int64 _id starting from 1, the last value of each collection is stored in the counters collection.
+ * every generated _id costs a command, including the ones of Upsert
+ */
+func SequenceStrategy() IDStrategy {
+	return sequenceStrategy{}
+}
+
+func (sequenceStrategy) Generate(ctx context.Context, collection string, counters Collection) (id any, err error) {
+	if counters == nil {
+		err = ErrNotConnected
+		return
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	result := counters.FindOneAndUpdate(ctx, bson.M{"_id": collection}, bson.M{"$inc": bson.M{"seq": int64(1)}}, opts)
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	if err = result.Decode(&counter); err != nil {
+		return
+	}
+	id = counter.Seq
+	return
+}
+
+func (sequenceStrategy) Parse(id string) (value any, err error) {
+	value, err = strconv.ParseInt(id, 10, 64)
+	return
+}
+
+// monotonic generate random bits after a millisecond timestamp, they are increased within the same millisecond
+// so ids of UUIDv7Strategy and ULIDStrategy keep the order of creation
+type monotonic struct {
+	// random bit count, at most 80
+	bits uint
+	mu   sync.Mutex
+	ms   uint64
+	hi   uint64
+	lo   uint64
+}
+
+func (m *monotonic) next() (ms uint64, hi uint64, lo uint64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := uint64(time.Now().UnixMilli())
+	if now > m.ms {
+		var b [10]byte
+		if _, err = rand.Read(b[:]); err != nil {
+			return
+		}
+		m.ms = now
+		// the top random bit is cleared to leave room for increments
+		m.hi = uint64(binary.BigEndian.Uint16(b[:2])) & (1<<(m.bits-64-1) - 1)
+		m.lo = binary.BigEndian.Uint64(b[2:])
+	} else {
+		m.lo++
+		if m.lo == 0 {
+			m.hi++
+		}
+	}
+
+	ms, hi, lo = m.ms, m.hi, m.lo
+	return
+}
+
+// putMillis write unix milliseconds to the first 6 bytes of b, big endian
+func putMillis(b []byte, ms uint64) {
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+// parseID convert an _id string by the id strategy
+func (e *Eloquent[T]) parseID(id string) (value any, err error) {
+	value, err = e.settings.idStrategy.Parse(id)
+	return
+}
+
+// newID generate _id of a new document by the id strategy
+func (e *Eloquent[T]) newID(ctx context.Context, operation string) (id any, err error) {
+	counters := e.settings.counters
+	if counters == nil {
+		if db := e.database(); db != nil {
+			counters = db.Collection(CountersCollection)
+		}
+	}
+
+	id, errG := e.settings.idStrategy.Generate(ctx, e.Collection, counters)
+	if errG != nil {
+		err = e.errMsg(operation, errG)
+	}
+	return
+}
+
+// database of connection, nil if not connected
+func (e *Eloquent[T]) database() *mongo.Database {
+	client := Connection(e.settings.connection)
+	if client == nil {
+		return nil
+	}
+
+	db := e.settings.database
+	if db == "" {
+		if cfg := connectionConfig(e.settings.connection); cfg != nil {
+			db = cfg.DB
+		}
+	}
+	return client.Database(db)
+}
@@ -0,0 +1,492 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declare an index of collection.
+// create it by Index or TextIndex, then chain Unique, Sparse, Partial, TTL or Named
+type IndexSpec struct {
+	name    string
+	keys    bson.D
+	unique  bool
+	sparse  bool
+	partial any
+	ttl     *int32
+}
+
+// listedIndex is an index listed from mongodb
+type listedIndex struct {
+	Name                    string `bson:"name"`
+	Key                     bson.D `bson:"key"`
+	Unique                  bool   `bson:"unique"`
+	Sparse                  bool   `bson:"sparse"`
+	ExpireAfterSeconds      any    `bson:"expireAfterSeconds"`
+	PartialFilterExpression any    `bson:"partialFilterExpression"`
+	Weights                 bson.M `bson:"weights"`
+}
+
+// IndexReport is the result of EnsureIndexes
+type IndexReport struct {
+	// index created by this call, including drifted index which was recreated
+	Created []string
+	// drifted index dropped by this call
+	Dropped []string
+	// index existed in collection but not declared by model, it would not be dropped
+	Unmanaged []string
+}
+
+/**
+ * @title declare a single or compound index
+ * @param fields ...string field name, prefix "-" for descending. ex: Index("name", "-age")
+ */
+func Index(fields ...string) IndexSpec {
+	keys := bson.D{}
+	for _, field := range fields {
+		if strings.HasPrefix(field, "-") {
+			keys = append(keys, bson.E{Key: strings.TrimPrefix(field, "-"), Value: -1})
+		} else {
+			keys = append(keys, bson.E{Key: field, Value: 1})
+		}
+	}
+	return IndexSpec{keys: keys}
+}
+
+/**
+ * @title declare a text index, one collection can only have one text index
+ */
+func TextIndex(fields ...string) IndexSpec {
+	keys := bson.D{}
+	for _, field := range fields {
+		keys = append(keys, bson.E{Key: field, Value: "text"})
+	}
+	return IndexSpec{keys: keys}
+}
+
+func (s IndexSpec) Unique() IndexSpec {
+	s.unique = true
+	return s
+}
+
+func (s IndexSpec) Sparse() IndexSpec {
+	s.sparse = true
+	return s
+}
+
+/**
+ * @title only index documents matching the filter
+ */
+func (s IndexSpec) Partial(filter any) IndexSpec {
+	s.partial = filter
+	return s
+}
+
+/**
+ * @title remove documents after seconds, field must be a date
+ */
+func (s IndexSpec) TTL(seconds int32) IndexSpec {
+	s.ttl = &seconds
+	return s
+}
+
+/**
+ * @title set index name. default is the name generated by mongodb ex: name_1_age_-1
+ */
+func (s IndexSpec) Named(name string) IndexSpec {
+	s.name = name
+	return s
+}
+
+/**
+ * @title index name
+ */
+func (s IndexSpec) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+
+	parts := []string{}
+	for _, key := range s.keys {
+		parts = append(parts, fmt.Sprintf("%s_%v", key.Key, key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+/**
+ * @title create missing indexes, drop and recreate drifted indexes declared by WithIndexes and model tags.
+ * an existing index with the same keys under another name is taken as the declared one.
+ * a drifted index which can not be recreated is restored
+ * @return report *IndexReport
+ * @return err error ErrInvalidConfig if an `orm` tag is malformed or unknown, or fail message from query
+ */
+func (e *Eloquent[T]) EnsureIndexes(ctx context.Context) (report *IndexReport, err error) {
+	report = &IndexReport{}
+
+	if e.settings.indexErr != nil {
+		err = e.errMsg("EnsureIndexes", e.settings.indexErr)
+		return
+	}
+
+	// index is only supported by mongodb
+	if e.settings.collection != nil {
+		return
+	}
+
+	coll := e.GetCollection()
+	if coll == nil {
+		err = e.errMsg("EnsureIndexes", ErrNotConnected)
+		return
+	}
+
+	cursor, errL := coll.Indexes().List(ctx)
+	if errL != nil {
+		logger.LogDebug.Error(e.logTitle, errL, getCurrentFuncInfo(1))
+		err = e.errMsg("EnsureIndexes", errL)
+		return
+	}
+
+	existing := []listedIndex{}
+	if errA := cursor.All(ctx, &existing); errA != nil {
+		logger.LogDebug.Error(e.logTitle, errA, getCurrentFuncInfo(1))
+		err = e.errMsg("EnsureIndexes", errA)
+		return
+	}
+
+	existingByName := map[string]listedIndex{}
+	for _, index := range existing {
+		existingByName[index.Name] = index
+	}
+
+	declared := map[string]bool{}
+	models := []mongo.IndexModel{}
+
+	for _, spec := range e.settings.indexes {
+		name := spec.Name()
+		declared[name] = true
+
+		current, exists := existingByName[name]
+		if !exists {
+			// mongodb rejects an index with the keys of an existing one, whatever its name
+			for _, index := range existing {
+				if index.Name != "_id_" && spec.sameKeys(index) {
+					current, exists = index, true
+					break
+				}
+			}
+		}
+		if exists {
+			declared[current.Name] = true
+		}
+		if exists && spec.matches(current) {
+			continue
+		}
+
+		if exists {
+			// an index can not be created beside another one with the same name or keys, so it is dropped first
+			// and restored if the drifted spec can not be created
+			if errR := e.recreateIndex(ctx, coll, spec, current, report); errR != nil {
+				logger.LogDebug.Error(e.logTitle, errR, getCurrentFuncInfo(1))
+				err = e.errMsg("EnsureIndexes", errR)
+				return
+			}
+			continue
+		}
+
+		models = append(models, spec.model())
+		report.Created = append(report.Created, name)
+	}
+
+	for _, index := range existing {
+		if index.Name != "_id_" && !declared[index.Name] {
+			report.Unmanaged = append(report.Unmanaged, index.Name)
+		}
+	}
+
+	if len(models) == 0 {
+		return
+	}
+
+	if _, errC := coll.Indexes().CreateMany(ctx, models); errC != nil {
+		logger.LogDebug.Error(e.logTitle, errC, getCurrentFuncInfo(1))
+		err = e.errMsg("EnsureIndexes", errC)
+		return
+	}
+	return
+}
+
+// recreateIndex replace a drifted index by spec, the original index is restored if spec can not be created
+func (e *Eloquent[T]) recreateIndex(ctx context.Context, coll *mongo.Collection, spec IndexSpec, current listedIndex, report *IndexReport) (err error) {
+	name := spec.Name()
+	if _, errD := coll.Indexes().DropOne(ctx, current.Name); errD != nil {
+		err = errD
+		return
+	}
+
+	_, errC := coll.Indexes().CreateOne(ctx, spec.model())
+	if errC == nil {
+		report.Dropped = append(report.Dropped, current.Name)
+		report.Created = append(report.Created, name)
+		return
+	}
+
+	if _, errR := coll.Indexes().CreateOne(ctx, current.model()); errR != nil {
+		report.Dropped = append(report.Dropped, current.Name)
+		err = fmt.Errorf("drifted index %s was dropped, creating %s failed: %w, restoring the original index failed: %v", current.Name, name, errC, errR)
+		return
+	}
+	err = fmt.Errorf("drifted index %s was not recreated as %s, the original index is kept: %w", current.Name, name, errC)
+	return
+}
+
+// model rebuild a listed index to restore it
+func (index listedIndex) model() mongo.IndexModel {
+	opts := options.Index().SetName(index.Name)
+	if index.Unique {
+		opts.SetUnique(true)
+	}
+	if index.Sparse {
+		opts.SetSparse(true)
+	}
+	if index.PartialFilterExpression != nil {
+		opts.SetPartialFilterExpression(index.PartialFilterExpression)
+	}
+	if index.ExpireAfterSeconds != nil {
+		if seconds, err := strconv.ParseInt(canonical(index.ExpireAfterSeconds), 10, 32); err == nil {
+			opts.SetExpireAfterSeconds(int32(seconds))
+		}
+	}
+
+	keys := index.Key
+	if len(index.Weights) > 0 {
+		// text index is listed by internal keys, rebuild it from weights
+		keys = bson.D{}
+		for _, field := range sortedKeys(index.Weights) {
+			keys = append(keys, bson.E{Key: field, Value: "text"})
+		}
+		opts.SetWeights(index.Weights)
+	}
+	return mongo.IndexModel{Keys: keys, Options: opts}
+}
+
+func (s IndexSpec) isText() bool {
+	for _, key := range s.keys {
+		if key.Value == "text" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s IndexSpec) model() mongo.IndexModel {
+	opts := options.Index().SetName(s.Name())
+	if s.unique {
+		opts.SetUnique(true)
+	}
+	if s.sparse {
+		opts.SetSparse(true)
+	}
+	if s.partial != nil {
+		opts.SetPartialFilterExpression(s.partial)
+	}
+	if s.ttl != nil {
+		opts.SetExpireAfterSeconds(*s.ttl)
+	}
+	return mongo.IndexModel{Keys: s.keys, Options: opts}
+}
+
+// matches compare spec with an index listed from mongodb, the name is not compared
+func (s IndexSpec) matches(index listedIndex) bool {
+	if index.Unique != s.unique || index.Sparse != s.sparse {
+		return false
+	}
+
+	if (index.ExpireAfterSeconds != nil) != (s.ttl != nil) {
+		return false
+	}
+	if s.ttl != nil && canonical(index.ExpireAfterSeconds) != canonical(*s.ttl) {
+		return false
+	}
+
+	if (index.PartialFilterExpression != nil) != (s.partial != nil) {
+		return false
+	}
+	if s.partial != nil && canonical(index.PartialFilterExpression) != canonical(s.partial) {
+		return false
+	}
+	return s.sameKeys(index)
+}
+
+// sameKeys compare keys of spec with an index listed from mongodb
+func (s IndexSpec) sameKeys(index listedIndex) bool {
+	if s.isText() {
+		fields := []string{}
+		for _, key := range s.keys {
+			fields = append(fields, key.Key)
+		}
+		weights := []string{}
+		for field := range index.Weights {
+			weights = append(weights, field)
+		}
+		sort.Strings(fields)
+		sort.Strings(weights)
+		return strings.Join(fields, ",") == strings.Join(weights, ",")
+	}
+
+	// key order of compound index is significant
+	if len(index.Key) != len(s.keys) {
+		return false
+	}
+	for i, key := range s.keys {
+		if index.Key[i].Key != key.Key || canonical(index.Key[i].Value) != canonical(key.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// canonical format a bson value as comparable string, numbers are compared by value and map keys are sorted
+func canonical(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bson.D:
+		return canonical(v.Map())
+	case bson.M:
+		return canonical(map[string]any(v))
+	case map[string]any:
+		keys := []string{}
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := []string{}
+		for _, key := range keys {
+			parts = append(parts, key+":"+canonical(v[key]))
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	case bson.A:
+		return canonical([]any(v))
+	case []any:
+		parts := []string{}
+		for _, item := range v {
+			parts = append(parts, canonical(item))
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	case int:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case int32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case int64:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return strconv.Quote(v)
+	}
+
+	// struct or other map type, encode and decode them to bson.M first
+	raw, err := bson.Marshal(bson.M{"v": value})
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	doc := bson.M{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return fmt.Sprint(value)
+	}
+	if reflect.TypeOf(doc["v"]) == reflect.TypeOf(value) {
+		return fmt.Sprint(value)
+	}
+	return canonical(doc["v"])
+}
+
+// modelIndexes read index declared by `orm` struct tag of model.
+// ex: `orm:"index"`, `orm:"unique"`, `orm:"index,desc,sparse"`, `orm:"ttl=3600"`, `orm:"text"`
+func modelIndexes(model reflect.Type) (specs []IndexSpec, err error) {
+	if model.Kind() != reflect.Struct {
+		return
+	}
+
+	text := []string{}
+	for i := 0; i < model.NumField(); i++ {
+		field := model.Field(i)
+		tag, ok := field.Tag.Lookup("orm")
+		if !ok {
+			continue
+		}
+
+		name := bsonFieldName(field)
+		if name == "" {
+			continue
+		}
+
+		indexed := false
+		spec := IndexSpec{}
+		order := 1
+		for _, token := range strings.Split(tag, ",") {
+			token = strings.TrimSpace(token)
+			switch {
+			case token == "index":
+				indexed = true
+			case token == "unique":
+				indexed = true
+				spec.unique = true
+			case token == "sparse":
+				spec.sparse = true
+			case token == "desc":
+				order = -1
+			case token == "text":
+				text = append(text, name)
+			case strings.HasPrefix(token, "ttl="):
+				seconds, errP := strconv.ParseInt(strings.TrimPrefix(token, "ttl="), 10, 32)
+				if errP != nil {
+					err = fmt.Errorf("%w: ttl of field %s: %v", ErrInvalidConfig, field.Name, errP)
+					return
+				}
+				indexed = true
+				spec = spec.TTL(int32(seconds))
+			case token == "":
+			default:
+				err = fmt.Errorf("%w: unknown orm tag %q of field %s", ErrInvalidConfig, token, field.Name)
+				return
+			}
+		}
+
+		if indexed {
+			spec.keys = bson.D{{Key: name, Value: order}}
+			specs = append(specs, spec)
+		}
+	}
+
+	if len(text) > 0 {
+		specs = append(specs, TextIndex(text...))
+	}
+	return
+}
+
+// bsonFieldName get document field name of struct field, empty if the field is skipped
+func bsonFieldName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+
+	tag := field.Tag.Get("bson")
+	name := strings.Split(tag, ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
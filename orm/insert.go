@@ -0,0 +1,195 @@
+package orm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// default document count of a batch of InsertMany
+const defaultInsertBatchSize = 1000
+
+// InsertOptions configure InsertMany, create it by NewInsertOptions
+type InsertOptions struct {
+	// document count sent by one InsertMany command
+	BatchSize int
+	// stop at the first failure, or insert all other documents
+	Ordered bool
+}
+
+/**
+ * @title options of InsertMany. default BatchSize=1000, Ordered=true
+ */
+func NewInsertOptions() *InsertOptions {
+	return &InsertOptions{BatchSize: defaultInsertBatchSize, Ordered: true}
+}
+
+/**
+ * @title document count sent by one InsertMany command
+ */
+func (o *InsertOptions) SetBatchSize(size int) *InsertOptions {
+	o.BatchSize = size
+	return o
+}
+
+/**
+ * @title stop at the first failure (true, default), or insert all other documents and report failures (false)
+ */
+func (o *InsertOptions) SetOrdered(ordered bool) *InsertOptions {
+	o.Ordered = ordered
+	return o
+}
+
+// InsertResult is the result of InsertMany, indexes are positions in the inserted slice
+type InsertResult struct {
+	InsertedCount int `json:"inserted_count"`
+	// index of data to _id of inserted document
+	InsertedIDs map[int]string `json:"inserted_ids"`
+	// failed documents, ordered insert stops at the first one
+	Errors []BulkError `json:"errors"`
+}
+
+/**
+ * @title indexes of documents not inserted because of a failure, including the ones skipped by ordered insert
+ * @param total int length of inserted slice
+ */
+func (r *InsertResult) FailedIndexes(total int) []int {
+	failed := []int{}
+	for i := 0; i < total; i++ {
+		if _, ok := r.InsertedIDs[i]; !ok {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+/**
+ * @title insert documents in batches, _id is generated if it is empty. BeforeInsert and AfterInsert hooks are called
+ * @param data []*T your model slice, nothing is sent if it is empty
+ * @param opts ...*InsertOptions batch size and ordered
+ * @return result *InsertResult inserted ids and failures by index of data, it is returned with the error of write failures
+ * @return err error ErrDuplicateKey ... if any document failed, or fail message from query
+ * @example result, err := userOrm.InsertMany(ctx, users, orm.NewInsertOptions().SetBatchSize(5000).SetOrdered(false))
+ */
+func (e *Eloquent[T]) InsertMany(ctx context.Context, data []*T, opts ...*InsertOptions) (result *InsertResult, err error) {
+	result, err = e.insertMany(ctx, "InsertMany", data, opts...)
+	return
+}
+
+func (e *Eloquent[T]) insertMany(ctx context.Context, operation string, data []*T, opts ...*InsertOptions) (result *InsertResult, err error) {
+	opt := NewInsertOptions()
+	for _, o := range opts {
+		if o != nil {
+			*opt = *o
+		}
+	}
+	if opt.BatchSize < 1 {
+		opt.BatchSize = defaultInsertBatchSize
+	}
+
+	result = &InsertResult{InsertedIDs: map[int]string{}, Errors: []BulkError{}}
+	if len(data) == 0 {
+		return
+	}
+
+	coll, errConn := e.collection(operation)
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	for start := 0; start < len(data); start += opt.BatchSize {
+		end := start + opt.BatchSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		batch := make([]any, 0, end-start)
+		ids := make([]any, 0, end-start)
+		for _, value := range data[start:end] {
+			doc, id, errD := e.insertDocument(ctx, operation, value)
+			if errD != nil {
+				err = errD
+				return
+			}
+			batch = append(batch, doc)
+			ids = append(ids, id)
+		}
+
+		_, errI := coll.InsertMany(ctx, batch, options.InsertMany().SetOrdered(opt.Ordered))
+
+		var exception mongo.BulkWriteException
+		if errI != nil && !errors.As(errI, &exception) {
+			logger.LogDebug.Error(e.logTitle, errI, getCurrentFuncInfo(2))
+			err = e.errMsg(operation, errI)
+			return
+		}
+
+		failed := map[int]bool{}
+		firstFailure := len(batch)
+		for _, writeErr := range exception.WriteErrors {
+			failed[writeErr.Index] = true
+			if writeErr.Index < firstFailure {
+				firstFailure = writeErr.Index
+			}
+			result.Errors = append(result.Errors, BulkError{Index: start + writeErr.Index, Code: writeErr.Code, Message: writeErr.Message})
+		}
+
+		for i, id := range ids {
+			if failed[i] || (opt.Ordered && i > firstFailure) {
+				continue
+			}
+			result.InsertedIDs[start+i] = idString(id)
+			e.setID(data[start+i], id)
+			result.InsertedCount++
+			if errH := afterInsert(ctx, data[start+i]); errH != nil && err == nil {
+				err = e.errMsg(operation, errH)
+			}
+		}
+
+		if errI != nil {
+			logger.LogDebug.Error(e.logTitle, errI, getCurrentFuncInfo(2))
+			err = e.errMsg(operation, errI)
+			if opt.Ordered {
+				return
+			}
+		}
+	}
+	return
+}
+
+// insertDocument encode data for insert, BeforeInsert hook is called and _id is generated by the id strategy if it is empty
+func (e *Eloquent[T]) insertDocument(ctx context.Context, operation string, data *T) (doc bson.D, id any, err error) {
+	if errH := beforeInsert(ctx, data); errH != nil {
+		err = e.errMsg(operation, errH)
+		return
+	}
+	if errT := e.timestamps.touch(data, true); errT != nil {
+		err = e.errMsg(operation, errT)
+		return
+	}
+
+	raw, errM := bson.Marshal(data)
+	if errM == nil {
+		errM = bson.Unmarshal(raw, &doc)
+	}
+	if errM != nil {
+		err = e.errMsg(operation, errM)
+		return
+	}
+
+	if value, errL := bson.Raw(raw).LookupErr("_id"); errL == nil {
+		id = value
+		return
+	}
+	if id, err = e.newID(ctx, operation); err != nil {
+		return
+	}
+	doc = append(bson.D{{Key: "_id", Value: id}}, doc...)
+	return
+}
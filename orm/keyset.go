@@ -0,0 +1,243 @@
+package orm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CursorPagination is a page of CursorPaginate.
+// pass NextCursor or PrevCursor back to CursorPaginate to get the adjacent page, empty means no more page
+type CursorPagination[T any] struct {
+	PerPage    int    `json:"per_page"`
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+	Data       []*T   `json:"data"`
+}
+
+// cursorToken is the content of an opaque cursor, values are sort keys of the document at the page boundary
+type cursorToken struct {
+	Prev   bool     `bson:"p,omitempty"`
+	Fields []string `bson:"f"`
+	Values bson.A   `bson:"v"`
+}
+
+func (c cursorToken) encode() (token string, err error) {
+	raw, err := bson.Marshal(c)
+	if err != nil {
+		return
+	}
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	return
+}
+
+func decodeCursor(token string, fields []string) (c *cursorToken, err error) {
+	raw, errB := base64.RawURLEncoding.DecodeString(token)
+	if errB != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidCursor, errB)
+		return
+	}
+
+	c = &cursorToken{}
+	if errU := bson.Unmarshal(raw, c); errU != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidCursor, errU)
+		return
+	}
+
+	if strings.Join(c.Fields, ",") != strings.Join(fields, ",") || len(c.Values) != len(fields) {
+		err = fmt.Errorf("%w: cursor was created with another sort", ErrInvalidCursor)
+		return
+	}
+	return
+}
+
+// keysetFields normalize sort fields, _id is appended as tie breaker so the order is total
+func keysetFields(sortFields []string) []string {
+	if len(sortFields) == 0 {
+		return []string{"-_id"}
+	}
+
+	fields := append([]string{}, sortFields...)
+	for _, field := range fields {
+		if strings.TrimPrefix(field, "-") == "_id" {
+			return fields
+		}
+	}
+
+	if strings.HasPrefix(fields[len(fields)-1], "-") {
+		return append(fields, "-_id")
+	}
+	return append(fields, "_id")
+}
+
+// keysetSort build sort of query, direction is reversed when reading backward
+func keysetSort(fields []string, prev bool) bson.D {
+	sort := bson.D{}
+	for _, field := range fields {
+		order := 1
+		if strings.HasPrefix(field, "-") {
+			order = -1
+		}
+		if prev {
+			order = -order
+		}
+		sort = append(sort, bson.E{Key: strings.TrimPrefix(field, "-"), Value: order})
+	}
+	return sort
+}
+
+// keysetFilter match documents after the cursor in the order of sort
+// ex: sort {age: 1, _id: 1} => {$or: [{age: {$gt: v0}}, {age: v0, _id: {$gt: v1}}]}
+func keysetFilter(sort bson.D, values bson.A) bson.M {
+	or := []any{}
+	for i, key := range sort {
+		cond := bson.M{}
+		for j := 0; j < i; j++ {
+			cond[sort[j].Key] = values[j]
+		}
+
+		op := "$gt"
+		if key.Value.(int) < 0 {
+			op = "$lt"
+		}
+		cond[key.Key] = bson.M{op: values[i]}
+		or = append(or, cond)
+	}
+	return bson.M{"$or": or}
+}
+
+// keysetValues read sort keys of a document
+func keysetValues(raw bson.Raw, sort bson.D) bson.A {
+	values := bson.A{}
+	for _, key := range sort {
+		value, errL := raw.LookupErr(strings.Split(key.Key, ".")...)
+		if errL != nil {
+			values = append(values, nil)
+			continue
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+/**
+ * @title paginate by cursor instead of page number, no count and no skip, pages stay stable while documents are inserted.
+ * documents with missing or null sort field are not supported
+ * @param limit int document count of a page. default=10
+ * @param cursor string NextCursor or PrevCursor of the previous call, empty for the first page
+ * @param filter any query condition
+ * @param sortFields ...string field name, prefix "-" for descending, _id is appended as tie breaker. default="-_id"
+ * @return paginated *CursorPagination[T]
+ * @return err error ErrInvalidCursor if cursor is broken or created with another sort, or fail message from query
+ */
+func (e *Eloquent[T]) CursorPaginate(ctx context.Context, limit int, cursor string, filter any, sortFields ...string) (paginated *CursorPagination[T], err error) {
+	coll, errConn := e.collection("CursorPaginate")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	if limit < 1 {
+		limit = 10
+	}
+
+	fields := keysetFields(sortFields)
+
+	var token *cursorToken
+	if cursor != "" {
+		var errT error
+		if token, errT = decodeCursor(cursor, fields); errT != nil {
+			logger.LogDebug.Error(e.logTitle, errT, getCurrentFuncInfo(1))
+			err = e.errMsg("CursorPaginate", errT)
+			return
+		}
+	}
+
+	prev := token != nil && token.Prev
+	sort := keysetSort(fields, prev)
+
+	query := e.scope(filter)
+	if token != nil {
+		keyset := keysetFilter(sort, token.Values)
+		if isEmptyFilter(query) {
+			query = keyset
+		} else {
+			query = bson.M{"$and": []any{query, keyset}}
+		}
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(sort)
+	findOptions.SetLimit(int64(limit + 1))
+
+	result, errF := coll.Find(ctx, query, findOptions)
+	if errF != nil {
+		logger.LogDebug.Error(e.logTitle, errF, getCurrentFuncInfo(1))
+		err = e.errMsg("CursorPaginate", errF)
+		return
+	}
+	defer result.Close(ctx)
+
+	data := []*T{}
+	raws := []bson.Raw{}
+	for result.Next(ctx) {
+		model := new(T)
+		if errD := result.Decode(model); errD != nil {
+			logger.LogDebug.Error(e.logTitle, errD, getCurrentFuncInfo(1))
+			err = e.errMsg("CursorPaginate", errD)
+			return
+		}
+		data = append(data, model)
+		raws = append(raws, append(bson.Raw{}, result.Current...))
+	}
+
+	if errC := result.Err(); errC != nil {
+		logger.LogDebug.Error(e.logTitle, errC, getCurrentFuncInfo(1))
+		err = e.errMsg("CursorPaginate", errC)
+		return
+	}
+
+	hasMore := len(data) > limit
+	if hasMore {
+		data = data[:limit]
+		raws = raws[:limit]
+	}
+
+	if prev {
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+			raws[i], raws[j] = raws[j], raws[i]
+		}
+	}
+
+	paginated = &CursorPagination[T]{PerPage: limit, Data: data}
+	if len(data) == 0 {
+		return
+	}
+
+	order := keysetSort(fields, false)
+	if hasMore || prev {
+		if paginated.NextCursor, err = (cursorToken{Fields: fields, Values: keysetValues(raws[len(raws)-1], order)}).encode(); err != nil {
+			err = e.errMsg("CursorPaginate", err)
+			return
+		}
+	}
+	if (prev && hasMore) || (!prev && token != nil) {
+		if paginated.PrevCursor, err = (cursorToken{Prev: true, Fields: fields, Values: keysetValues(raws[0], order)}).encode(); err != nil {
+			err = e.errMsg("CursorPaginate", err)
+			return
+		}
+	}
+
+	if errH := e.afterFind(ctx, data...); errH != nil {
+		err = e.errMsg("CursorPaginate", errH)
+		return
+	}
+	return
+}
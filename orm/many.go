@@ -0,0 +1,423 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ManyToMany is a many to many relation between parent T and related R, create it by BelongsToMany or BelongsToManyPivot.
+// register it by DefineRelation for eager loading, and change the mapping by Attach, Detach and Sync
+type ManyToMany[T any, R any] struct {
+	name    string
+	parent  *Eloquent[T]
+	related IEloquent[R]
+	// reference array style: array field of parent document holding _id of related documents, ex: role_ids
+	localKey string
+	// pivot collection style: one document per pair, ex: {product_id, tag_id, ...extra fields}
+	pivot           func(operation string) (Collection, error)
+	foreignPivotKey string
+	relatedPivotKey string
+}
+
+/**
+ * @title many to many stored as an array of related _id on parent document, ex: user.role_ids
+ * @param name string relation name, loaded into the model field of the same name (case insensitive) ex: Roles []*Role `bson:"-"`
+ * @param parent *Eloquent[T] eloquent of parent model, updated by Attach, Detach and Sync
+ * @param related IEloquent[R] eloquent of related model
+ * @param localKey string array field of parent document, ex: role_ids
+ * @example roles := orm.BelongsToMany[User, Role]("roles", userOrm, roleOrm, "role_ids")
+ */
+func BelongsToMany[T any, R any](name string, parent *Eloquent[T], related IEloquent[R], localKey string) *ManyToMany[T, R] {
+	return &ManyToMany[T, R]{name: name, parent: parent, related: related, localKey: localKey}
+}
+
+/**
+ * @title many to many stored in a pivot collection, pivot documents can have extra fields.
+ * if R has a field named Pivot, it is filled with the pivot document by eager loading
+ * @param name string relation name, loaded into the model field of the same name (case insensitive) ex: Tags []*Tag `bson:"-"`
+ * @param parent *Eloquent[T] eloquent of parent model
+ * @param related IEloquent[R] eloquent of related model
+ * @param pivot *Eloquent[P] eloquent of pivot collection, ex: orm.NewEloquent[map[string]any]("product_tag")
+ * @param foreignPivotKey string field of pivot document referring to parent, ex: product_id
+ * @param relatedPivotKey string field of pivot document referring to related, ex: tag_id
+ * @example tags := orm.BelongsToManyPivot[Product, Tag]("tags", productOrm, tagOrm, pivotOrm, "product_id", "tag_id")
+ */
+func BelongsToManyPivot[T any, R any, P any](name string, parent *Eloquent[T], related IEloquent[R], pivot *Eloquent[P], foreignPivotKey, relatedPivotKey string) *ManyToMany[T, R] {
+	return &ManyToMany[T, R]{
+		name:            name,
+		parent:          parent,
+		related:         related,
+		pivot:           pivot.collection,
+		foreignPivotKey: foreignPivotKey,
+		relatedPivotKey: relatedPivotKey,
+	}
+}
+
+func (m *ManyToMany[T, R]) Name() string {
+	return m.name
+}
+
+// referenceKey store ObjectID for hex id, other id as it is. used for related ids when related is not an *Eloquent
+func referenceKey(id string) any {
+	if objId, err := primitive.ObjectIDFromHex(id); err == nil {
+		return objId
+	}
+	return id
+}
+
+// parentKey convert parent _id string by the id strategy of parent
+func (m *ManyToMany[T, R]) parentKey(operation string, id string) (key any, err error) {
+	key, errP := m.parent.parseID(id)
+	if errP != nil {
+		err = m.parent.errInvalidID(operation, errP)
+	}
+	return
+}
+
+// relatedKeys convert related _id strings by the id strategy of related, duplicates are removed
+func (m *ManyToMany[T, R]) relatedKeys(operation string, ids []string) (keys []any, err error) {
+	related, _ := m.related.(*Eloquent[R])
+	keys = []any{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if related == nil {
+			keys = append(keys, referenceKey(id))
+			continue
+		}
+		key, errP := related.parseID(id)
+		if errP != nil {
+			err = m.parent.errInvalidID(operation, errP)
+			return
+		}
+		keys = append(keys, key)
+	}
+	return
+}
+
+/**
+ * @title relate parent to related documents, existing pairs are kept
+ * @param parentID string _id of parent document
+ * @param relatedIDs ...string _id of related documents
+ * @return err error ErrNotFound if parent does not exist (reference array style), or fail message from query
+ */
+func (m *ManyToMany[T, R]) Attach(ctx context.Context, parentID string, relatedIDs ...string) (err error) {
+	if len(relatedIDs) == 0 {
+		return
+	}
+
+	keys, err := m.relatedKeys("Attach", relatedIDs)
+	if err != nil {
+		return
+	}
+
+	if m.pivot == nil {
+		err = m.updateParent(ctx, "Attach", parentID, bson.M{"$addToSet": bson.M{m.localKey: bson.M{"$each": keys}}})
+		return
+	}
+
+	for _, key := range keys {
+		if err = m.upsertPivot(ctx, "Attach", parentID, key, nil); err != nil {
+			return
+		}
+	}
+	return
+}
+
+/**
+ * @title relate parent to a related document with extra fields on the pivot document, only for BelongsToManyPivot
+ * @param fields map[string]any extra fields, ex: bson.M{"level": 2}. fields of an existing pair are updated
+ * @return err error ErrInvalidConfig if relation has no pivot collection, or fail message from query
+ */
+func (m *ManyToMany[T, R]) AttachPivot(ctx context.Context, parentID string, relatedID string, fields map[string]any) (err error) {
+	if m.pivot == nil {
+		err = m.parent.errMsg("AttachPivot", fmt.Errorf("%w: relation %q has no pivot collection", ErrInvalidConfig, m.name))
+		return
+	}
+	keys, err := m.relatedKeys("AttachPivot", []string{relatedID})
+	if err != nil {
+		return
+	}
+	err = m.upsertPivot(ctx, "AttachPivot", parentID, keys[0], fields)
+	return
+}
+
+/**
+ * @title remove relations between parent and related documents, related documents are not deleted
+ * @param relatedIDs ...string _id of related documents, empty for all
+ * @return err error ErrNotFound if parent does not exist (reference array style), or fail message from query
+ */
+func (m *ManyToMany[T, R]) Detach(ctx context.Context, parentID string, relatedIDs ...string) (err error) {
+	keys, err := m.relatedKeys("Detach", relatedIDs)
+	if err != nil {
+		return
+	}
+
+	if m.pivot == nil {
+		update := bson.M{"$set": bson.M{m.localKey: []any{}}}
+		if len(keys) > 0 {
+			update = bson.M{"$pullAll": bson.M{m.localKey: keys}}
+		}
+		err = m.updateParent(ctx, "Detach", parentID, update)
+		return
+	}
+
+	parentKey, err := m.parentKey("Detach", parentID)
+	if err != nil {
+		return
+	}
+	filter := bson.M{m.foreignPivotKey: parentKey}
+	if len(keys) > 0 {
+		filter[m.relatedPivotKey] = bson.M{"$in": keys}
+	}
+	err = m.deletePivot(ctx, "Detach", filter)
+	return
+}
+
+/**
+ * @title make related documents of parent exactly relatedIDs, others are detached. extra fields of kept pivot documents are not changed
+ * @param relatedIDs []string _id of related documents, empty to detach all
+ * @return err error ErrNotFound if parent does not exist (reference array style), or fail message from query
+ */
+func (m *ManyToMany[T, R]) Sync(ctx context.Context, parentID string, relatedIDs []string) (err error) {
+	keys, err := m.relatedKeys("Sync", relatedIDs)
+	if err != nil {
+		return
+	}
+
+	if m.pivot == nil {
+		err = m.updateParent(ctx, "Sync", parentID, bson.M{"$set": bson.M{m.localKey: keys}})
+		return
+	}
+
+	parentKey, err := m.parentKey("Sync", parentID)
+	if err != nil {
+		return
+	}
+	if err = m.deletePivot(ctx, "Sync", bson.M{m.foreignPivotKey: parentKey, m.relatedPivotKey: bson.M{"$nin": keys}}); err != nil {
+		return
+	}
+	for _, key := range keys {
+		if err = m.upsertPivot(ctx, "Sync", parentID, key, nil); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (m *ManyToMany[T, R]) updateParent(ctx context.Context, operation string, parentID string, update bson.M) (err error) {
+	parentKey, err := m.parentKey(operation, parentID)
+	if err != nil {
+		return
+	}
+
+	coll, errConn := m.parent.collection(operation)
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	result, errU := coll.UpdateOne(ctx, m.parent.scope(bson.M{"_id": parentKey}), update)
+	if errU != nil {
+		logger.LogDebug.Error(m.parent.logTitle, errU, getCurrentFuncInfo(2))
+		err = m.parent.errMsg(operation, errU)
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		err = m.parent.errMsg(operation, ErrNotFound)
+		return
+	}
+	return
+}
+
+func (m *ManyToMany[T, R]) upsertPivot(ctx context.Context, operation string, parentID string, relatedKey any, fields map[string]any) (err error) {
+	parentKey, err := m.parentKey(operation, parentID)
+	if err != nil {
+		return
+	}
+
+	coll, errConn := m.pivot(operation)
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	pair := bson.M{m.foreignPivotKey: parentKey, m.relatedPivotKey: relatedKey}
+	update := bson.M{"$setOnInsert": pair}
+	if len(fields) > 0 {
+		update["$set"] = fields
+	}
+
+	if _, errU := coll.UpdateOne(ctx, pair, update, options.Update().SetUpsert(true)); errU != nil {
+		logger.LogDebug.Error(m.parent.logTitle, errU, getCurrentFuncInfo(2))
+		err = m.parent.errMsg(operation, errU)
+		return
+	}
+	return
+}
+
+func (m *ManyToMany[T, R]) deletePivot(ctx context.Context, operation string, filter bson.M) (err error) {
+	coll, errConn := m.pivot(operation)
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	if _, errD := coll.DeleteMany(ctx, filter); errD != nil {
+		logger.LogDebug.Error(m.parent.logTitle, errD, getCurrentFuncInfo(2))
+		err = m.parent.errMsg(operation, errD)
+		return
+	}
+	return
+}
+
+func (m *ManyToMany[T, R]) eagerLoad(ctx context.Context, parents reflect.Value, nested []string) (err error) {
+	if m.pivot == nil {
+		r := &relation[R]{name: m.name, kind: belongsToMany, related: m.related, parentKey: m.localKey, relatedKey: "_id"}
+		err = r.eagerLoad(ctx, parents, nested)
+		return
+	}
+
+	if parents.Len() == 0 {
+		return
+	}
+
+	field, err := relationField(parents.Type().Elem().Elem(), m.name)
+	if err != nil {
+		return
+	}
+
+	keys := relationKeys{}
+	parentKeys := make([][]string, parents.Len())
+	for i := 0; i < parents.Len(); i++ {
+		if parentKeys[i], err = keys.add(parents.Index(i).Interface(), "_id"); err != nil {
+			return
+		}
+	}
+
+	byParent, relatedKeys, err := m.pivotRows(ctx, keys.values)
+	if err != nil {
+		return
+	}
+
+	byKey := map[string]*R{}
+	if len(relatedKeys.values) > 0 {
+		related := m.related
+		if len(nested) > 0 {
+			related = related.With(nested...)
+		}
+
+		models, errF := related.FindMultiple(ctx, bson.M{"_id": bson.M{"$in": relatedKeys.values}})
+		if errF != nil {
+			err = errF
+			return
+		}
+
+		for _, model := range models {
+			modelKeys, errK := (&relationKeys{}).add(model, "_id")
+			if errK != nil {
+				err = errK
+				return
+			}
+			for _, key := range modelKeys {
+				byKey[key] = model
+			}
+		}
+	}
+
+	pivotField, hasPivot := reflect.StructField{}, false
+	if model := reflect.TypeOf((*R)(nil)).Elem(); model.Kind() == reflect.Struct {
+		pivotField, hasPivot = model.FieldByName("Pivot")
+	}
+
+	for i := 0; i < parents.Len(); i++ {
+		matched := []*R{}
+		for _, key := range parentKeys[i] {
+			for _, row := range byParent[key] {
+				model, ok := byKey[row.related]
+				if !ok {
+					continue
+				}
+
+				if hasPivot {
+					// each parent gets its own copy, pivot fields differ between parents
+					clone := *model
+					target := reflect.ValueOf(&clone).Elem().FieldByIndex(pivotField.Index)
+					if err = bson.Unmarshal(row.raw, target.Addr().Interface()); err != nil {
+						return
+					}
+					model = &clone
+				}
+				matched = append(matched, model)
+			}
+		}
+		assignMany(parents.Index(i).Elem().FieldByIndex(field.Index), matched)
+	}
+	return
+}
+
+// pivotRow is a pivot document with canonical keys of both sides
+type pivotRow struct {
+	related string
+	raw     bson.Raw
+}
+
+// pivotRows read pivot documents of parents, grouped by canonical parent key
+func (m *ManyToMany[T, R]) pivotRows(ctx context.Context, parentKeys []any) (byParent map[string][]pivotRow, relatedKeys *relationKeys, err error) {
+	byParent = map[string][]pivotRow{}
+	relatedKeys = &relationKeys{}
+	if len(parentKeys) == 0 {
+		return
+	}
+
+	coll, err := m.pivot("With")
+	if err != nil {
+		return
+	}
+
+	cursor, errF := coll.Find(ctx, bson.M{m.foreignPivotKey: bson.M{"$in": parentKeys}})
+	if errF != nil {
+		logger.LogDebug.Error(m.parent.logTitle, errF, getCurrentFuncInfo(1))
+		err = m.parent.errMsg("With", errF)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		raw := append(bson.Raw{}, cursor.Current...)
+		parents, errP := (&relationKeys{}).add(raw, m.foreignPivotKey)
+		if errP != nil {
+			err = errP
+			return
+		}
+		related, errR := relatedKeys.add(raw, m.relatedPivotKey)
+		if errR != nil {
+			err = errR
+			return
+		}
+
+		for _, parent := range parents {
+			for _, key := range related {
+				byParent[parent] = append(byParent[parent], pivotRow{related: key, raw: raw})
+			}
+		}
+	}
+	if errC := cursor.Err(); errC != nil {
+		logger.LogDebug.Error(m.parent.logTitle, errC, getCurrentFuncInfo(1))
+		err = m.parent.errMsg("With", errC)
+		return
+	}
+	return
+}
@@ -0,0 +1,779 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Aggregate run a pipeline. supported stages: $match, $sort, $skip, $limit, $count, $unwind, $group, $project,
+// $addFields, $set, $unset, $replaceRoot, $replaceWith, $facet, $bucket and $lookup (collection of a Database only)
+func (c *Collection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (cursor *mongo.Cursor, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	stages, err := toValue(pipeline)
+	if err != nil {
+		return
+	}
+	list, ok := stages.(bson.A)
+	if !ok {
+		err = fmt.Errorf("memory: pipeline must be an array of stages")
+		return
+	}
+
+	c.mu.RLock()
+	docs, err := c.filter(nil)
+	c.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	if docs, err = c.runPipeline(docs, list); err != nil {
+		return
+	}
+
+	documents := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		documents = append(documents, doc)
+	}
+	cursor, err = mongo.NewCursorFromDocuments(documents, nil, nil)
+	return
+}
+
+func (c *Collection) runPipeline(docs []bson.D, stages bson.A) ([]bson.D, error) {
+	for _, item := range stages {
+		stage, ok := item.(bson.D)
+		if !ok || len(stage) != 1 {
+			return nil, fmt.Errorf("memory: a pipeline stage must be a document with one field")
+		}
+
+		var err error
+		if docs, err = c.runStage(docs, stage[0].Key, stage[0].Value); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+func (c *Collection) runStage(docs []bson.D, operator string, spec any) (result []bson.D, err error) {
+	switch operator {
+	case "$match":
+		filter, ok := spec.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("memory: $match needs a document")
+		}
+		result = []bson.D{}
+		for _, doc := range docs {
+			matched, errM := match(doc, filter)
+			if errM != nil {
+				return nil, errM
+			}
+			if matched {
+				result = append(result, doc)
+			}
+		}
+		return
+	case "$sort":
+		err = sortDocs(docs, spec)
+		return docs, err
+	case "$skip", "$limit":
+		n, ok := toFloat(spec)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("memory: %s needs a positive number", operator)
+		}
+		if operator == "$skip" {
+			return page(docs, int64(n), 0), nil
+		}
+		return page(docs, 0, int64(n)), nil
+	case "$count":
+		field, ok := spec.(string)
+		if !ok || field == "" {
+			return nil, fmt.Errorf("memory: $count needs a field name")
+		}
+		if len(docs) == 0 {
+			return []bson.D{}, nil
+		}
+		return []bson.D{{{Key: field, Value: int32(len(docs))}}}, nil
+	case "$unwind":
+		return unwind(docs, spec)
+	case "$group":
+		group, ok := spec.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("memory: $group needs a document")
+		}
+		id, _ := get(group, "_id")
+		accumulators := bson.D{}
+		for _, e := range group {
+			if e.Key != "_id" {
+				accumulators = append(accumulators, e)
+			}
+		}
+		return groupDocs(docs, accumulators, func(doc bson.D) (any, error) {
+			return eval(doc, id)
+		})
+	case "$bucket":
+		return bucket(docs, spec)
+	case "$project":
+		fields, ok := spec.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("memory: $project needs a document")
+		}
+		return mapDocs(docs, func(doc bson.D) (bson.D, error) {
+			return projectExpr(doc, fields)
+		})
+	case "$addFields", "$set":
+		fields, ok := spec.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("memory: %s needs a document", operator)
+		}
+		return mapDocs(docs, func(doc bson.D) (bson.D, error) {
+			return addFields(doc, doc, fields)
+		})
+	case "$unset":
+		fields := bson.A{spec}
+		if list, ok := spec.(bson.A); ok {
+			fields = list
+		}
+		return mapDocs(docs, func(doc bson.D) (bson.D, error) {
+			var result any = doc
+			for _, field := range fields {
+				result = unsetPath(result, split(stringOf(field)))
+			}
+			return result.(bson.D), nil
+		})
+	case "$replaceRoot", "$replaceWith":
+		root := spec
+		if operator == "$replaceRoot" {
+			root, _ = get(toD(spec), "newRoot")
+		}
+		return mapDocs(docs, func(doc bson.D) (bson.D, error) {
+			value, errE := eval(doc, root)
+			if errE != nil {
+				return nil, errE
+			}
+			newRoot, ok := value.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("memory: %s needs a document", operator)
+			}
+			return newRoot, nil
+		})
+	case "$facet":
+		facets, ok := spec.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("memory: $facet needs a document")
+		}
+		output := bson.D{}
+		for _, facet := range facets {
+			stages, ok := facet.Value.(bson.A)
+			if !ok {
+				return nil, fmt.Errorf("memory: $facet %s needs a pipeline", facet.Key)
+			}
+			input := make([]bson.D, len(docs))
+			copy(input, docs)
+			facetDocs, errF := c.runPipeline(input, stages)
+			if errF != nil {
+				return nil, errF
+			}
+			arr := bson.A{}
+			for _, doc := range facetDocs {
+				arr = append(arr, doc)
+			}
+			output = append(output, bson.E{Key: facet.Key, Value: arr})
+		}
+		return []bson.D{output}, nil
+	case "$lookup":
+		return c.lookup(docs, spec)
+	}
+	return nil, fmt.Errorf("memory: unsupported stage %s", operator)
+}
+
+func toD(value any) bson.D {
+	doc, _ := value.(bson.D)
+	return doc
+}
+
+func mapDocs(docs []bson.D, fn func(bson.D) (bson.D, error)) ([]bson.D, error) {
+	result := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		mapped, err := fn(doc)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, mapped)
+	}
+	return result, nil
+}
+
+func unwind(docs []bson.D, spec any) ([]bson.D, error) {
+	path, preserve := stringOf(spec), false
+	if options, ok := spec.(bson.D); ok {
+		value, _ := get(options, "path")
+		keep, _ := get(options, "preserveNullAndEmptyArrays")
+		path, preserve = stringOf(value), truthy(keep)
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("memory: $unwind path must start with $")
+	}
+	parts := split(strings.TrimPrefix(path, "$"))
+
+	result := []bson.D{}
+	for _, doc := range docs {
+		value, found := getPath(doc, parts)
+		arr, isArr := value.(bson.A)
+		switch {
+		case isArr && len(arr) > 0:
+			for _, item := range arr {
+				unwound, _ := setPath(doc, parts, item)
+				result = append(result, unwound.(bson.D))
+			}
+		case isArr || !found || value == nil:
+			if preserve {
+				result = append(result, doc)
+			}
+		default:
+			result = append(result, doc)
+		}
+	}
+	return result, nil
+}
+
+// groupDocs group documents by key, groups keep the order they are first seen
+func groupDocs(docs []bson.D, accumulators bson.D, key func(bson.D) (any, error)) ([]bson.D, error) {
+	ids := bson.A{}
+	members := [][]bson.D{}
+
+	for _, doc := range docs {
+		id, err := key(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		index := -1
+		for i, existing := range ids {
+			if equal(existing, id) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			ids = append(ids, id)
+			members = append(members, []bson.D{})
+			index = len(ids) - 1
+		}
+		members[index] = append(members[index], doc)
+	}
+
+	result := make([]bson.D, 0, len(ids))
+	for i, id := range ids {
+		output := bson.D{{Key: "_id", Value: id}}
+		for _, acc := range accumulators {
+			value, err := accumulate(members[i], acc.Value)
+			if err != nil {
+				return nil, err
+			}
+			output = append(output, bson.E{Key: acc.Key, Value: value})
+		}
+		result = append(result, output)
+	}
+	return result, nil
+}
+
+func accumulate(docs []bson.D, spec any) (any, error) {
+	acc, ok := spec.(bson.D)
+	if !ok || len(acc) != 1 {
+		return nil, fmt.Errorf("memory: accumulator must be a document with one operator")
+	}
+	operator, expr := acc[0].Key, acc[0].Value
+
+	values := bson.A{}
+	for _, doc := range docs {
+		value, err := eval(doc, expr)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	switch operator {
+	case "$sum":
+		return sum(values), nil
+	case "$avg":
+		return avg(values), nil
+	case "$min", "$max":
+		return extreme(values, operator == "$max"), nil
+	case "$first":
+		if len(values) == 0 {
+			return nil, nil
+		}
+		return values[0], nil
+	case "$last":
+		if len(values) == 0 {
+			return nil, nil
+		}
+		return values[len(values)-1], nil
+	case "$push":
+		return values, nil
+	case "$addToSet":
+		set := bson.A{}
+		for _, value := range values {
+			if !contains(set, value) {
+				set = append(set, value)
+			}
+		}
+		return set, nil
+	case "$count":
+		return int32(len(docs)), nil
+	}
+	return nil, fmt.Errorf("memory: unsupported accumulator %s", operator)
+}
+
+func sum(values bson.A) any {
+	var total any = int32(0)
+	for _, value := range values {
+		if _, ok := toFloat(value); ok {
+			total = arithmetic(total, value, "$inc")
+		}
+	}
+	return total
+}
+
+func avg(values bson.A) any {
+	total, count := 0.0, 0
+	for _, value := range values {
+		if f, ok := toFloat(value); ok {
+			total += f
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	return total / float64(count)
+}
+
+func extreme(values bson.A, max bool) any {
+	var result any
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		if result == nil || (max && compare(value, result) > 0) || (!max && compare(value, result) < 0) {
+			result = value
+		}
+	}
+	return result
+}
+
+func bucket(docs []bson.D, spec any) ([]bson.D, error) {
+	options := toD(spec)
+	groupBy, _ := get(options, "groupBy")
+	defaultID, hasDefault := get(options, "default")
+	boundaries, ok := func() (bson.A, bool) {
+		value, _ := get(options, "boundaries")
+		arr, ok := value.(bson.A)
+		return arr, ok && len(arr) >= 2
+	}()
+	if !ok {
+		return nil, fmt.Errorf("memory: $bucket needs at least 2 boundaries")
+	}
+
+	output := bson.D{{Key: "count", Value: bson.D{{Key: "$sum", Value: int32(1)}}}}
+	if value, ok := get(options, "output"); ok {
+		output = toD(value)
+	}
+
+	grouped, err := groupDocs(docs, output, func(doc bson.D) (any, error) {
+		value, err := eval(doc, groupBy)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(boundaries)-1; i++ {
+			if typeRank(value) == typeRank(boundaries[i]) && compare(value, boundaries[i]) >= 0 && compare(value, boundaries[i+1]) < 0 {
+				return boundaries[i], nil
+			}
+		}
+		if !hasDefault {
+			return nil, fmt.Errorf("memory: $bucket value %v is out of boundaries and no default is set", value)
+		}
+		return defaultID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// buckets are ordered by boundaries, default bucket is the last
+	position := func(doc bson.D) int {
+		id, _ := get(doc, "_id")
+		for i, boundary := range boundaries {
+			if equal(id, boundary) {
+				return i
+			}
+		}
+		return len(boundaries)
+	}
+	sort.SliceStable(grouped, func(i, j int) bool {
+		return position(grouped[i]) < position(grouped[j])
+	})
+	return grouped, nil
+}
+
+func projectExpr(doc bson.D, fields bson.D) (bson.D, error) {
+	include := false
+	for _, field := range fields {
+		if field.Key == "_id" {
+			continue
+		}
+		switch field.Value.(type) {
+		case bool, int32, int64, float64:
+			include = include || truthy(field.Value)
+		default:
+			include = true
+		}
+	}
+
+	if !include {
+		return project(doc, fields)
+	}
+
+	var result any = bson.D{}
+	if id, ok := get(doc, "_id"); ok {
+		if keep, set := get(fields, "_id"); !set || truthy(keep) {
+			result, _ = setPath(result, []string{"_id"}, id)
+		}
+	}
+
+	for _, field := range fields {
+		switch field.Value.(type) {
+		case bool, int32, int64, float64:
+			if field.Key == "_id" || !truthy(field.Value) {
+				continue
+			}
+			if value, ok := getPath(doc, split(field.Key)); ok {
+				result, _ = setPath(result, split(field.Key), value)
+			}
+			continue
+		}
+
+		if ref, ok := field.Value.(string); ok && strings.HasPrefix(ref, "$") && !strings.HasPrefix(ref, "$$") {
+			if _, found := getPath(doc, split(ref[1:])); !found {
+				continue
+			}
+		}
+		value, err := eval(doc, field.Value)
+		if err != nil {
+			return nil, err
+		}
+		result, _ = setPath(result, split(field.Key), value)
+	}
+	return result.(bson.D), nil
+}
+
+func addFields(root bson.D, doc bson.D, fields bson.D) (bson.D, error) {
+	var result any = doc
+	for _, field := range fields {
+		value, err := eval(root, field.Value)
+		if err != nil {
+			return nil, err
+		}
+		result, _ = setPath(result, split(field.Key), value)
+	}
+	return result.(bson.D), nil
+}
+
+func (c *Collection) lookup(docs []bson.D, spec any) ([]bson.D, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("memory: $lookup needs a collection created by Database")
+	}
+
+	options := toD(spec)
+	from, _ := get(options, "from")
+	localField, _ := get(options, "localField")
+	foreignField, _ := get(options, "foreignField")
+	as, _ := get(options, "as")
+	if stringOf(from) == "" || stringOf(localField) == "" || stringOf(foreignField) == "" || stringOf(as) == "" {
+		return nil, fmt.Errorf("memory: $lookup needs from, localField, foreignField and as")
+	}
+
+	foreign := c.db.Collection(stringOf(from))
+	foreign.mu.RLock()
+	defer foreign.mu.RUnlock()
+
+	return mapDocs(docs, func(doc bson.D) (bson.D, error) {
+		locals := expand(resolve(doc, split(stringOf(localField))))
+		if len(locals) == 0 {
+			locals = []any{nil}
+		}
+
+		joined := bson.A{}
+		for _, candidate := range foreign.docs {
+			if anyEqual(resolve(candidate, split(stringOf(foreignField))), locals) {
+				joined = append(joined, candidate)
+			}
+		}
+		result, _ := setPath(doc, split(stringOf(as)), joined)
+		return result.(bson.D), nil
+	})
+}
+
+func anyEqual(values []any, list []any) bool {
+	for _, item := range list {
+		if matchEqual(values, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// eval evaluate an aggregation expression against doc, missing field is nil
+func eval(doc bson.D, expr any) (any, error) {
+	switch v := expr.(type) {
+	case string:
+		switch {
+		case v == "$$ROOT" || v == "$$CURRENT":
+			return doc, nil
+		case strings.HasPrefix(v, "$$"):
+			return nil, fmt.Errorf("memory: unsupported variable %s", v)
+		case strings.HasPrefix(v, "$"):
+			return fieldPath(doc, split(v[1:])), nil
+		}
+		return v, nil
+	case bson.A:
+		arr := bson.A{}
+		for _, item := range v {
+			value, err := eval(doc, item)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		return arr, nil
+	case bson.D:
+		if isOperatorDoc(v) && len(v) == 1 {
+			return evalOperator(doc, v[0].Key, v[0].Value)
+		}
+		return addFields(doc, bson.D{}, v)
+	}
+	return expr, nil
+}
+
+// fieldPath get value of "$a.b", arrays of documents are mapped
+func fieldPath(value any, parts []string) any {
+	if len(parts) == 0 {
+		return value
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		child, ok := get(v, parts[0])
+		if !ok {
+			return nil
+		}
+		return fieldPath(child, parts[1:])
+	case bson.A:
+		arr := bson.A{}
+		for _, item := range v {
+			if _, ok := item.(bson.D); !ok {
+				continue
+			}
+			if child := fieldPath(item, parts); child != nil {
+				arr = append(arr, child)
+			}
+		}
+		return arr
+	}
+	return nil
+}
+
+func evalArgs(doc bson.D, args any) (bson.A, error) {
+	list, ok := args.(bson.A)
+	if !ok {
+		list = bson.A{args}
+	}
+	values := bson.A{}
+	for _, arg := range list {
+		value, err := eval(doc, arg)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func evalOperator(doc bson.D, operator string, args any) (any, error) {
+	if operator == "$literal" {
+		return args, nil
+	}
+	if operator == "$cond" {
+		if spec, ok := args.(bson.D); ok {
+			ifExpr, _ := get(spec, "if")
+			thenExpr, _ := get(spec, "then")
+			elseExpr, _ := get(spec, "else")
+			args = bson.A{ifExpr, thenExpr, elseExpr}
+		}
+	}
+
+	values, err := evalArgs(doc, args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operator {
+	case "$add", "$multiply":
+		var result any = int32(0)
+		if operator == "$multiply" {
+			result = int32(1)
+		}
+		for _, value := range values {
+			if value == nil {
+				return nil, nil
+			}
+			if _, ok := toFloat(value); !ok {
+				return nil, fmt.Errorf("memory: %s only supports numbers", operator)
+			}
+			if operator == "$add" {
+				result = arithmetic(result, value, "$inc")
+			} else {
+				result = arithmetic(result, value, "$mul")
+			}
+		}
+		return result, nil
+	case "$subtract", "$divide", "$mod":
+		if len(values) != 2 {
+			return nil, fmt.Errorf("memory: %s needs 2 arguments", operator)
+		}
+		if values[0] == nil || values[1] == nil {
+			return nil, nil
+		}
+		a, okA := toFloat(values[0])
+		b, okB := toFloat(values[1])
+		if !okA || !okB {
+			return nil, fmt.Errorf("memory: %s only supports numbers", operator)
+		}
+		switch operator {
+		case "$subtract":
+			return arithmetic(values[0], negate(values[1]), "$inc"), nil
+		case "$divide":
+			if b == 0 {
+				return nil, fmt.Errorf("memory: can't $divide by zero")
+			}
+			return a / b, nil
+		}
+		if b == 0 {
+			return nil, fmt.Errorf("memory: can't $mod by zero")
+		}
+		return math.Mod(a, b), nil
+	case "$concat":
+		var builder strings.Builder
+		for _, value := range values {
+			if value == nil {
+				return nil, nil
+			}
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("memory: $concat only supports strings")
+			}
+			builder.WriteString(s)
+		}
+		return builder.String(), nil
+	case "$toLower", "$toUpper":
+		if len(values) != 1 {
+			return nil, fmt.Errorf("memory: %s needs 1 argument", operator)
+		}
+		if operator == "$toLower" {
+			return strings.ToLower(stringOf(values[0])), nil
+		}
+		return strings.ToUpper(stringOf(values[0])), nil
+	case "$ifNull":
+		for _, value := range values {
+			if value != nil {
+				return value, nil
+			}
+		}
+		return nil, nil
+	case "$size":
+		arr, ok := values[0].(bson.A)
+		if len(values) != 1 || !ok {
+			return nil, fmt.Errorf("memory: $size needs an array")
+		}
+		return int32(len(arr)), nil
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+		if len(values) != 2 {
+			return nil, fmt.Errorf("memory: %s needs 2 arguments", operator)
+		}
+		c := compare(values[0], values[1])
+		switch operator {
+		case "$eq":
+			return c == 0, nil
+		case "$ne":
+			return c != 0, nil
+		case "$gt":
+			return c > 0, nil
+		case "$gte":
+			return c >= 0, nil
+		case "$lt":
+			return c < 0, nil
+		}
+		return c <= 0, nil
+	case "$and":
+		for _, value := range values {
+			if !truthy(value) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "$or":
+		for _, value := range values {
+			if truthy(value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$not":
+		return !truthy(values[0]), nil
+	case "$cond":
+		if len(values) != 3 {
+			return nil, fmt.Errorf("memory: $cond needs if, then and else")
+		}
+		if truthy(values[0]) {
+			return values[1], nil
+		}
+		return values[2], nil
+	case "$sum":
+		return sum(flatten(values)), nil
+	case "$avg":
+		return avg(flatten(values)), nil
+	case "$min", "$max":
+		return extreme(flatten(values), operator == "$max"), nil
+	}
+	return nil, fmt.Errorf("memory: unsupported expression operator %s", operator)
+}
+
+// flatten a single array argument of $sum, $avg, $min and $max
+func flatten(values bson.A) bson.A {
+	if len(values) == 1 {
+		if arr, ok := values[0].(bson.A); ok {
+			return arr
+		}
+	}
+	return values
+}
+
+func negate(value any) any {
+	switch v := value.(type) {
+	case int32:
+		return -int64(v)
+	case int64:
+		return -v
+	}
+	f, _ := toFloat(value)
+	return -f
+}
@@ -0,0 +1,804 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/orm"
+)
+
+// mongodb server error code of duplicate key
+const duplicateKeyCode = 11000
+
+// Collection is an in-memory orm.Collection, documents live until the process exits or Drop is called.
+// it is safe for concurrent use
+type Collection struct {
+	name string
+	// database of collection, nil if it is created by NewCollection. $lookup reads other collections from it
+	db   *Database
+	mu   sync.RWMutex
+	docs []bson.D
+}
+
+var _ orm.Collection = (*Collection)(nil)
+
+/**
+ * @title create an empty in-memory collection
+ * @param name string collection name used in error message
+ */
+func NewCollection(name string) *Collection {
+	return &Collection{name: name}
+}
+
+// Name is collection name
+func (c *Collection) Name() string {
+	return c.name
+}
+
+/**
+ * @title remove every document
+ */
+func (c *Collection) Drop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.docs = nil
+}
+
+func (c *Collection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (cursor *mongo.Cursor, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	opt := options.MergeFindOptions(opts...)
+
+	c.mu.RLock()
+	docs, err := c.filter(filter)
+	c.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	if err = sortDocs(docs, opt.Sort); err != nil {
+		return
+	}
+
+	var skip, limit int64
+	if opt.Skip != nil {
+		skip = *opt.Skip
+	}
+	if opt.Limit != nil {
+		limit = *opt.Limit
+		if limit < 0 {
+			limit = -limit
+		}
+	}
+	docs = page(docs, skip, limit)
+
+	documents := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		projected, errP := project(doc, opt.Projection)
+		if errP != nil {
+			err = errP
+			return
+		}
+		documents = append(documents, projected)
+	}
+
+	cursor, err = mongo.NewCursorFromDocuments(documents, nil, nil)
+	return
+}
+
+func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	findOpt := options.Find().SetLimit(1)
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.Sort != nil {
+			findOpt.SetSort(opt.Sort)
+		}
+		if opt.Skip != nil {
+			findOpt.SetSkip(*opt.Skip)
+		}
+		if opt.Projection != nil {
+			findOpt.SetProjection(opt.Projection)
+		}
+	}
+
+	cursor, err := c.Find(ctx, filter, findOpt)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(cursor.Current, nil, nil)
+}
+
+func (c *Collection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (result *mongo.InsertOneResult, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, errI := c.insert(document)
+	if errI != nil {
+		var writeErr mongo.WriteError
+		if writeErr, err = toWriteError(0, errI); err == nil {
+			err = mongo.WriteException{WriteErrors: mongo.WriteErrors{writeErr}}
+		}
+		return
+	}
+
+	result = &mongo.InsertOneResult{InsertedID: id}
+	return
+}
+
+func (c *Collection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (result *mongo.InsertManyResult, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if len(documents) == 0 {
+		err = mongo.ErrEmptySlice
+		return
+	}
+
+	ordered := true
+	if opt := options.MergeInsertManyOptions(opts...); opt.Ordered != nil {
+		ordered = *opt.Ordered
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result = &mongo.InsertManyResult{InsertedIDs: []interface{}{}}
+	writeErrors := []mongo.BulkWriteError{}
+	for i, document := range documents {
+		id, errI := c.insert(document)
+		if errI != nil {
+			writeErr, errW := toWriteError(i, errI)
+			if errW != nil {
+				err = errW
+				return
+			}
+			writeErrors = append(writeErrors, mongo.BulkWriteError{
+				WriteError: writeErr,
+				Request:    mongo.NewInsertOneModel().SetDocument(document),
+			})
+			if ordered {
+				break
+			}
+			continue
+		}
+		result.InsertedIDs = append(result.InsertedIDs, id)
+	}
+
+	if len(writeErrors) > 0 {
+		err = mongo.BulkWriteException{WriteErrors: writeErrors}
+	}
+	return
+}
+
+func (c *Collection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.update(ctx, filter, update, false, opts...)
+}
+
+func (c *Collection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.update(ctx, filter, update, true, opts...)
+}
+
+func (c *Collection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.delete(ctx, filter, false)
+}
+
+func (c *Collection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.delete(ctx, filter, true)
+}
+
+func (c *Collection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	opt := options.MergeFindOneAndUpdateOptions(opts...)
+
+	modify, err := c.updater(update)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+
+	after := opt.ReturnDocument != nil && *opt.ReturnDocument == options.After
+	upsert := opt.Upsert != nil && *opt.Upsert
+	return c.findAndModify(ctx, filter, opt.Sort, opt.Projection, after, upsert, modify)
+}
+
+func (c *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) *mongo.SingleResult {
+	opt := options.MergeFindOneAndDeleteOptions(opts...)
+	return c.findAndModify(ctx, filter, opt.Sort, opt.Projection, false, false, func(doc bson.D, inserting bool) (bson.D, error) {
+		return nil, nil
+	})
+}
+
+func (c *Collection) FindOneAndReplace(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.FindOneAndReplaceOptions) *mongo.SingleResult {
+	opt := options.MergeFindOneAndReplaceOptions(opts...)
+
+	normalized, err := toDoc(replacement)
+	if err == nil && isUpdateDoc(normalized) && len(normalized) > 0 {
+		err = fmt.Errorf("memory: replacement document cannot contain keys beginning with '$'")
+	}
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+
+	after := opt.ReturnDocument != nil && *opt.ReturnDocument == options.After
+	upsert := opt.Upsert != nil && *opt.Upsert
+	return c.findAndModify(ctx, filter, opt.Sort, opt.Projection, after, upsert, func(doc bson.D, inserting bool) (bson.D, error) {
+		return replace(doc, normalized)
+	})
+}
+
+func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (result *mongo.BulkWriteResult, err error) {
+	if len(models) == 0 {
+		err = mongo.ErrEmptySlice
+		return
+	}
+
+	opt := options.MergeBulkWriteOptions(opts...)
+	ordered := opt.Ordered == nil || *opt.Ordered
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	result = &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{}}
+	bulkErrors := []mongo.BulkWriteError{}
+	for i, model := range models {
+		errW := c.writeModel(ctx, result, int64(i), model)
+		if errW == nil {
+			continue
+		}
+
+		writeErr, errOther := toWriteError(i, errW)
+		if errOther != nil {
+			err = errOther
+			return
+		}
+		bulkErrors = append(bulkErrors, mongo.BulkWriteError{WriteError: writeErr, Request: model})
+		if ordered {
+			break
+		}
+	}
+
+	if len(bulkErrors) > 0 {
+		err = mongo.BulkWriteException{WriteErrors: bulkErrors}
+	}
+	return
+}
+
+// writeModel run an operation of BulkWrite and add its counts to result
+func (c *Collection) writeModel(ctx context.Context, result *mongo.BulkWriteResult, index int64, model mongo.WriteModel) (err error) {
+	var updated *mongo.UpdateResult
+	switch m := model.(type) {
+	case *mongo.InsertOneModel:
+		c.mu.Lock()
+		_, err = c.insert(m.Document)
+		c.mu.Unlock()
+		if err == nil {
+			result.InsertedCount++
+		}
+	case *mongo.UpdateOneModel:
+		updated, err = c.UpdateOne(ctx, m.Filter, m.Update, &options.UpdateOptions{Upsert: m.Upsert})
+	case *mongo.UpdateManyModel:
+		updated, err = c.UpdateMany(ctx, m.Filter, m.Update, &options.UpdateOptions{Upsert: m.Upsert})
+	case *mongo.ReplaceOneModel:
+		updated, err = c.replaceOne(ctx, m.Filter, m.Replacement, m.Upsert != nil && *m.Upsert)
+	case *mongo.DeleteOneModel:
+		var deleted *mongo.DeleteResult
+		if deleted, err = c.DeleteOne(ctx, m.Filter); err == nil {
+			result.DeletedCount += deleted.DeletedCount
+		}
+	case *mongo.DeleteManyModel:
+		var deleted *mongo.DeleteResult
+		if deleted, err = c.DeleteMany(ctx, m.Filter); err == nil {
+			result.DeletedCount += deleted.DeletedCount
+		}
+	default:
+		err = fmt.Errorf("memory: unsupported write model %T", model)
+	}
+
+	if updated != nil {
+		result.MatchedCount += updated.MatchedCount
+		result.ModifiedCount += updated.ModifiedCount
+		if updated.UpsertedID != nil {
+			result.UpsertedCount++
+			result.UpsertedIDs[index] = updated.UpsertedID
+		}
+	}
+	return
+}
+
+// replaceOne replace the first matched document, or insert replacement if upsert is true
+func (c *Collection) replaceOne(ctx context.Context, filter interface{}, replacement interface{}, upsert bool) (result *mongo.UpdateResult, err error) {
+	normalized, err := toDoc(replacement)
+	if err != nil {
+		return
+	}
+
+	result = &mongo.UpdateResult{}
+	var upsertedID interface{}
+	err = c.findAndModify(ctx, filter, nil, nil, false, upsert, func(doc bson.D, inserting bool) (bson.D, error) {
+		replaced, errR := replace(doc, normalized)
+		if errR != nil {
+			return nil, errR
+		}
+		if !inserting {
+			result.MatchedCount = 1
+			if !equal(doc, replaced) {
+				result.ModifiedCount = 1
+			}
+			return replaced, nil
+		}
+
+		id, found := get(replaced, "_id")
+		if !found {
+			id = primitive.NewObjectID()
+			replaced = append(bson.D{{Key: "_id", Value: id}}, replaced...)
+		}
+		upsertedID = id
+		return replaced, nil
+	}).Err()
+
+	if err == mongo.ErrNoDocuments {
+		err = nil
+	}
+	if err != nil {
+		result = nil
+		return
+	}
+	if upsertedID != nil {
+		result.UpsertedCount = 1
+		result.UpsertedID = upsertedID
+	}
+	return
+}
+
+func (c *Collection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (count int64, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.mu.RLock()
+	docs, err := c.filter(filter)
+	c.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	var skip, limit int64
+	opt := options.MergeCountOptions(opts...)
+	if opt.Skip != nil {
+		skip = *opt.Skip
+	}
+	if opt.Limit != nil {
+		limit = *opt.Limit
+	}
+
+	count = int64(len(page(docs, skip, limit)))
+	return
+}
+
+func (c *Collection) EstimatedDocumentCount(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (count int64, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	count = int64(len(c.docs))
+	return
+}
+
+func (c *Collection) Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) (values []interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.mu.RLock()
+	docs, err := c.filter(filter)
+	c.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	distinct := bson.A{}
+	for _, doc := range docs {
+		for _, value := range resolve(doc, split(fieldName)) {
+			candidates := bson.A{value}
+			if arr, ok := value.(bson.A); ok {
+				candidates = arr
+			}
+			for _, candidate := range candidates {
+				if !contains(distinct, candidate) {
+					distinct = append(distinct, candidate)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(distinct, func(i, j int) bool {
+		return compare(distinct[i], distinct[j]) < 0
+	})
+	values = distinct
+	return
+}
+
+// filter return copies of matched documents, caller must hold the lock
+func (c *Collection) filter(filter interface{}) (docs []bson.D, err error) {
+	indexes, err := c.matchIndexes(filter, true)
+	if err != nil {
+		return
+	}
+
+	docs = make([]bson.D, 0, len(indexes))
+	for _, i := range indexes {
+		docs = append(docs, append(bson.D{}, c.docs[i]...))
+	}
+	return
+}
+
+// matchIndexes return position of matched documents, caller must hold the lock
+func (c *Collection) matchIndexes(filter interface{}, many bool) (indexes []int, err error) {
+	normalized, err := toDoc(filter)
+	if err != nil {
+		return
+	}
+
+	for i, doc := range c.docs {
+		matched, errM := match(doc, normalized)
+		if errM != nil {
+			err = errM
+			return
+		}
+		if !matched {
+			continue
+		}
+		indexes = append(indexes, i)
+		if !many {
+			return
+		}
+	}
+	return
+}
+
+// insert store document and return its _id, caller must hold the lock
+func (c *Collection) insert(document interface{}) (id interface{}, err error) {
+	doc, err := toDoc(document)
+	if err != nil {
+		return
+	}
+
+	id, ok := get(doc, "_id")
+	if !ok {
+		id = primitive.NewObjectID()
+		doc = append(bson.D{{Key: "_id", Value: id}}, doc...)
+	}
+
+	for _, existing := range c.docs {
+		if existingID, _ := get(existing, "_id"); equal(existingID, id) {
+			err = &duplicateKeyError{collection: c.name, id: id}
+			return
+		}
+	}
+
+	c.docs = append(c.docs, doc)
+	return
+}
+
+func (c *Collection) update(ctx context.Context, filter interface{}, update interface{}, many bool, opts ...*options.UpdateOptions) (result *mongo.UpdateResult, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	modify, err := c.updater(update)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	indexes, err := c.matchIndexes(filter, many)
+	if err != nil {
+		return
+	}
+
+	result = &mongo.UpdateResult{}
+	updated := make(map[int]bson.D, len(indexes))
+	for _, i := range indexes {
+		doc, errU := modify(c.docs[i], false)
+		if errU != nil {
+			result = nil
+			err = errU
+			return
+		}
+		result.MatchedCount++
+		if !equal(c.docs[i], doc) {
+			result.ModifiedCount++
+		}
+		updated[i] = doc
+	}
+	for i, doc := range updated {
+		c.docs[i] = doc
+	}
+
+	opt := options.MergeUpdateOptions(opts...)
+	if len(indexes) > 0 || opt.Upsert == nil || !*opt.Upsert {
+		return
+	}
+
+	normalizedFilter, err := toDoc(filter)
+	if err != nil {
+		result = nil
+		return
+	}
+	doc, err := modify(upsertDoc(normalizedFilter), true)
+	if err != nil {
+		result = nil
+		return
+	}
+
+	id, err := c.insert(doc)
+	if err != nil {
+		result = nil
+		return
+	}
+	result.UpsertedCount = 1
+	result.UpsertedID = id
+	return
+}
+
+func (c *Collection) delete(ctx context.Context, filter interface{}, many bool) (result *mongo.DeleteResult, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	indexes, err := c.matchIndexes(filter, many)
+	if err != nil {
+		return
+	}
+
+	removed := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		removed[i] = true
+	}
+
+	kept := make([]bson.D, 0, len(c.docs)-len(indexes))
+	for i, doc := range c.docs {
+		if !removed[i] {
+			kept = append(kept, doc)
+		}
+	}
+	c.docs = kept
+
+	result = &mongo.DeleteResult{DeletedCount: int64(len(indexes))}
+	return
+}
+
+// first return position of the first matched document in sort order, -1 if none, caller must hold the lock
+func (c *Collection) first(filter interface{}, sortBy interface{}) (index int, err error) {
+	index = -1
+	indexes, err := c.matchIndexes(filter, sortBy != nil)
+	if err != nil || len(indexes) == 0 {
+		return
+	}
+
+	if sortBy == nil {
+		index = indexes[0]
+		return
+	}
+
+	docs := make([]bson.D, 0, len(indexes))
+	for _, i := range indexes {
+		docs = append(docs, c.docs[i])
+	}
+	if err = sortDocs(docs, sortBy); err != nil {
+		return
+	}
+
+	id, _ := get(docs[0], "_id")
+	for _, i := range indexes {
+		if existingID, _ := get(c.docs[i], "_id"); equal(existingID, id) {
+			index = i
+			return
+		}
+	}
+	return
+}
+
+// findAndModify change the first matched document in sort order by modify, a nil result of modify removes the document.
+// if nothing matched and upsert is true, the document built from equality conditions of filter is modified and inserted.
+// return the projected document before or after the change
+func (c *Collection) findAndModify(ctx context.Context, filter interface{}, sortBy interface{}, projection interface{}, after bool, upsert bool, modify func(doc bson.D, inserting bool) (bson.D, error)) *mongo.SingleResult {
+	result, err := func() (result bson.D, err error) {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		index, err := c.first(filter, sortBy)
+		if err != nil {
+			return
+		}
+
+		if index < 0 {
+			if !upsert {
+				err = mongo.ErrNoDocuments
+				return
+			}
+
+			normalizedFilter, errF := toDoc(filter)
+			if errF != nil {
+				err = errF
+				return
+			}
+			doc, errM := modify(upsertDoc(normalizedFilter), true)
+			if errM != nil {
+				err = errM
+				return
+			}
+			if _, err = c.insert(doc); err != nil {
+				return
+			}
+			if !after {
+				err = mongo.ErrNoDocuments
+				return
+			}
+			result = c.docs[len(c.docs)-1]
+			return
+		}
+
+		before := c.docs[index]
+		doc, err := modify(before, false)
+		if err != nil {
+			return
+		}
+
+		if doc == nil {
+			c.docs = append(c.docs[:index:index], c.docs[index+1:]...)
+			result = before
+			return
+		}
+
+		c.docs[index] = doc
+		result = before
+		if after {
+			result = doc
+		}
+		return
+	}()
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+
+	projected, err := project(append(bson.D{}, result...), projection)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	return mongo.NewSingleResultFromDocument(projected, nil, nil)
+}
+
+type duplicateKeyError struct {
+	collection string
+	id         interface{}
+}
+
+func (e *duplicateKeyError) Error() string {
+	return fmt.Sprintf("E11000 duplicate key error collection: %s index: _id_ dup key: { _id: %v }", e.collection, e.id)
+}
+
+// toWriteError convert duplicate key error to the write error returned by mongodb
+func toWriteError(index int, err error) (writeErr mongo.WriteError, errOther error) {
+	if _, ok := err.(*duplicateKeyError); !ok {
+		errOther = err
+		return
+	}
+
+	writeErr = mongo.WriteError{Index: index, Code: duplicateKeyCode, Message: err.Error()}
+	return
+}
+
+func page(docs []bson.D, skip, limit int64) []bson.D {
+	if skip >= int64(len(docs)) {
+		return []bson.D{}
+	}
+	docs = docs[skip:]
+	if limit > 0 && limit < int64(len(docs)) {
+		docs = docs[:limit]
+	}
+	return docs
+}
+
+// sortDocs sort documents by a sort document like {age: -1, _id: 1}
+func sortDocs(docs []bson.D, sortBy interface{}) error {
+	if sortBy == nil {
+		return nil
+	}
+
+	keys, err := toDoc(sortBy)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, key := range keys {
+			direction, _ := toFloat(key.Value)
+			a, _ := getPath(docs[i], split(key.Key))
+			b, _ := getPath(docs[j], split(key.Key))
+			c := compare(a, b)
+			if c == 0 {
+				continue
+			}
+			if direction < 0 {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+// project apply an inclusion or exclusion projection
+func project(doc bson.D, projection interface{}) (bson.D, error) {
+	if projection == nil {
+		return doc, nil
+	}
+
+	fields, err := toDoc(projection)
+	if err != nil || len(fields) == 0 {
+		return doc, err
+	}
+
+	include := false
+	for _, field := range fields {
+		if field.Key != "_id" && truthy(field.Value) {
+			include = true
+		}
+	}
+
+	if !include {
+		var result any = doc
+		for _, field := range fields {
+			result = unsetPath(result, split(field.Key))
+		}
+		return result.(bson.D), nil
+	}
+
+	var result any = bson.D{}
+	if id, ok := get(doc, "_id"); ok {
+		if keep, set := get(fields, "_id"); !set || truthy(keep) {
+			result, _ = setPath(result, []string{"_id"}, id)
+		}
+	}
+	for _, field := range fields {
+		if field.Key == "_id" || !truthy(field.Value) {
+			continue
+		}
+		if value, ok := getPath(doc, split(field.Key)); ok {
+			result, _ = setPath(result, split(field.Key), value)
+		}
+	}
+	return result.(bson.D), nil
+}
@@ -0,0 +1,264 @@
+package memory
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// match report whether doc matches a normalized filter
+func match(doc bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		ok, err := matchElement(doc, e)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchElement(doc bson.D, e bson.E) (bool, error) {
+	switch e.Key {
+	case "$and", "$or", "$nor":
+		filters, ok := e.Value.(bson.A)
+		if !ok || len(filters) == 0 {
+			return false, fmt.Errorf("memory: %s must be a nonempty array", e.Key)
+		}
+		for _, item := range filters {
+			sub, ok := item.(bson.D)
+			if !ok {
+				return false, fmt.Errorf("memory: %s entries must be documents", e.Key)
+			}
+			matched, err := match(doc, sub)
+			if err != nil {
+				return false, err
+			}
+			switch {
+			case e.Key == "$and" && !matched:
+				return false, nil
+			case e.Key == "$or" && matched:
+				return true, nil
+			case e.Key == "$nor" && matched:
+				return false, nil
+			}
+		}
+		return e.Key != "$or", nil
+	}
+
+	if strings.HasPrefix(e.Key, "$") {
+		return false, fmt.Errorf("memory: unsupported operator %s", e.Key)
+	}
+
+	values := resolve(doc, split(e.Key))
+	return matchValues(values, e.Value)
+}
+
+func isOperatorDoc(value any) bool {
+	doc, ok := value.(bson.D)
+	return ok && len(doc) > 0 && strings.HasPrefix(doc[0].Key, "$")
+}
+
+// expand add elements of array values, a condition matches an array if it matches any element
+func expand(values []any) []any {
+	expanded := []any{}
+	for _, value := range values {
+		expanded = append(expanded, value)
+		if arr, ok := value.(bson.A); ok {
+			expanded = append(expanded, arr...)
+		}
+	}
+	return expanded
+}
+
+// matchValues report whether values found at a path satisfy cond
+func matchValues(values []any, cond any) (bool, error) {
+	if !isOperatorDoc(cond) {
+		return matchEqual(values, cond), nil
+	}
+
+	ops := cond.(bson.D)
+	for _, op := range ops {
+		ok, err := matchOperator(values, op, ops)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchEqual(values []any, cond any) bool {
+	if regex, ok := cond.(primitive.Regex); ok {
+		return matchRegex(values, regex.Pattern, regex.Options)
+	}
+	if cond == nil && len(values) == 0 {
+		return true
+	}
+	for _, value := range expand(values) {
+		if equal(value, cond) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchIn(values []any, cond any, operator string) (bool, error) {
+	list, ok := cond.(bson.A)
+	if !ok {
+		return false, fmt.Errorf("memory: %s needs an array", operator)
+	}
+	for _, item := range list {
+		if matchEqual(values, item) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchCompare(values []any, cond any, accept func(int) bool) bool {
+	for _, value := range expand(values) {
+		if _, isArr := value.(bson.A); isArr {
+			if _, condArr := cond.(bson.A); !condArr {
+				continue
+			}
+		}
+		if typeRank(value) == typeRank(cond) && accept(compare(value, cond)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegex(values []any, pattern string, options string) bool {
+	flags := ""
+	for _, o := range options {
+		if strings.ContainsRune("ims", o) {
+			flags += string(o)
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	for _, value := range expand(values) {
+		if s, ok := value.(string); ok && re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int32, int64, float64:
+		f, _ := toFloat(v)
+		return f != 0
+	}
+	return true
+}
+
+func matchOperator(values []any, op bson.E, ops bson.D) (bool, error) {
+	switch op.Key {
+	case "$eq":
+		return matchEqual(values, op.Value), nil
+	case "$ne":
+		return !matchEqual(values, op.Value), nil
+	case "$gt":
+		return matchCompare(values, op.Value, func(c int) bool { return c > 0 }), nil
+	case "$gte":
+		return matchCompare(values, op.Value, func(c int) bool { return c >= 0 }), nil
+	case "$lt":
+		return matchCompare(values, op.Value, func(c int) bool { return c < 0 }), nil
+	case "$lte":
+		return matchCompare(values, op.Value, func(c int) bool { return c <= 0 }), nil
+	case "$in":
+		return matchIn(values, op.Value, op.Key)
+	case "$nin":
+		ok, err := matchIn(values, op.Value, op.Key)
+		return !ok, err
+	case "$exists":
+		return (len(values) > 0) == truthy(op.Value), nil
+	case "$regex":
+		options, _ := get(ops, "$options")
+		switch v := op.Value.(type) {
+		case string:
+			return matchRegex(values, v, stringOf(options)), nil
+		case primitive.Regex:
+			return matchRegex(values, v.Pattern, v.Options+stringOf(options)), nil
+		}
+		return false, fmt.Errorf("memory: $regex needs a string")
+	case "$options":
+		return true, nil
+	case "$not":
+		ok, err := matchValues(values, op.Value)
+		return !ok, err
+	case "$size":
+		size, ok := toFloat(op.Value)
+		if !ok {
+			return false, fmt.Errorf("memory: $size needs a number")
+		}
+		for _, value := range values {
+			if arr, isArr := value.(bson.A); isArr && float64(len(arr)) == size {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		list, ok := op.Value.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("memory: $all needs an array")
+		}
+		if len(list) == 0 {
+			return false, nil
+		}
+		for _, item := range list {
+			if !matchEqual(values, item) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "$elemMatch":
+		cond, ok := op.Value.(bson.D)
+		if !ok {
+			return false, fmt.Errorf("memory: $elemMatch needs a document")
+		}
+		for _, value := range values {
+			arr, isArr := value.(bson.A)
+			if !isArr {
+				continue
+			}
+			for _, item := range arr {
+				matched, err := matchElem(item, cond)
+				if err != nil {
+					return false, err
+				}
+				if matched {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("memory: unsupported operator %s", op.Key)
+}
+
+// matchElem match an array element against an $elemMatch or $pull condition
+func matchElem(item any, cond bson.D) (bool, error) {
+	if isOperatorDoc(cond) {
+		return matchValues([]any{item}, cond)
+	}
+	doc, ok := item.(bson.D)
+	if !ok {
+		return false, nil
+	}
+	return match(doc, cond)
+}
@@ -0,0 +1,58 @@
+// Package memory is an in-memory storage of eloquent for unit tests, no mongodb is needed.
+// filter, update operators, sort, skip, limit, projection and common aggregation stages follow mongodb semantics,
+// index and transaction are not supported
+package memory
+
+import (
+	"sync"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/orm"
+)
+
+// Database is a set of in-memory collections
+type Database struct {
+	mu          sync.Mutex
+	collections map[string]*Collection
+}
+
+/**
+ * @title create an empty in-memory database
+ */
+func NewDatabase() *Database {
+	return &Database{collections: map[string]*Collection{}}
+}
+
+/**
+ * @title get collection by name, it is created on first use
+ */
+func (db *Database) Collection(name string) *Collection {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	coll, ok := db.collections[name]
+	if !ok {
+		coll = NewCollection(name)
+		coll.db = db
+		db.collections[name] = coll
+	}
+	return coll
+}
+
+/**
+ * @title remove every collection
+ */
+func (db *Database) Drop() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.collections = map[string]*Collection{}
+}
+
+/**
+ * @title create eloquent stored in db, it can replace orm.NewEloquent in unit tests
+ * @param collection string collection name
+ * @param opts ...orm.Option same options as orm.NewEloquent
+ */
+func NewEloquent[T any](db *Database, collection string, opts ...orm.Option) *orm.Eloquent[T] {
+	opts = append([]orm.Option{orm.WithCollection(db.Collection(collection)), orm.WithCounters(db.Collection(orm.CountersCollection))}, opts...)
+	return orm.NewEloquent[T](collection, opts...)
+}
@@ -0,0 +1,359 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errUpdateOperator = errors.New("update document must contain key beginning with '$'")
+
+// isUpdateDoc report whether update uses update operators instead of replacing the document
+func isUpdateDoc(update bson.D) bool {
+	return len(update) > 0 && strings.HasPrefix(update[0].Key, "$")
+}
+
+// updater build the function applying update to a copy of a document, update is a document of operators or an update pipeline
+func (c *Collection) updater(update any) (modify func(doc bson.D, inserting bool) (bson.D, error), err error) {
+	normalized, err := toValue(update)
+	if err != nil {
+		return
+	}
+
+	switch value := normalized.(type) {
+	case bson.A:
+		modify = func(doc bson.D, inserting bool) (bson.D, error) {
+			return c.applyPipeline(doc, value)
+		}
+	case bson.D:
+		if !isUpdateDoc(value) {
+			err = errUpdateOperator
+			return
+		}
+		modify = func(doc bson.D, inserting bool) (bson.D, error) {
+			return applyUpdate(doc, value, inserting)
+		}
+	default:
+		err = errUpdateOperator
+	}
+	return
+}
+
+// applyPipeline run stages of an update pipeline on a copy of doc, _id can not be changed
+func (c *Collection) applyPipeline(doc bson.D, pipeline bson.A) (result bson.D, err error) {
+	for _, item := range pipeline {
+		stage, ok := item.(bson.D)
+		if !ok || len(stage) != 1 {
+			err = fmt.Errorf("memory: a pipeline stage must be a document with one field")
+			return
+		}
+		switch stage[0].Key {
+		case "$addFields", "$set", "$project", "$unset", "$replaceRoot", "$replaceWith":
+		default:
+			err = fmt.Errorf("memory: %s is not allowed in an update pipeline", stage[0].Key)
+			return
+		}
+	}
+
+	docs, err := c.runPipeline([]bson.D{append(bson.D{}, doc...)}, pipeline)
+	if err != nil {
+		return
+	}
+	result = docs[0]
+
+	id, found := get(doc, "_id")
+	newID, kept := get(result, "_id")
+	switch {
+	case found && !kept:
+		result = append(bson.D{{Key: "_id", Value: id}}, result...)
+	case found && !equal(id, newID):
+		err = fmt.Errorf("memory: the (immutable) field '_id' was found to have been altered")
+	}
+	return
+}
+
+// applyUpdate apply update operators to a copy of doc
+// @param inserting bool $setOnInsert is applied only when the document is upserted
+func applyUpdate(doc bson.D, update bson.D, inserting bool) (result bson.D, err error) {
+	if !isUpdateDoc(update) {
+		err = errUpdateOperator
+		return
+	}
+
+	var current any = append(bson.D{}, doc...)
+	for _, op := range update {
+		fields, ok := op.Value.(bson.D)
+		if !ok {
+			err = fmt.Errorf("memory: %s needs a document", op.Key)
+			return
+		}
+
+		for _, field := range fields {
+			if field.Key == "_id" && op.Key != "$setOnInsert" && !inserting {
+				if old, found := get(doc, "_id"); !found || !equal(old, field.Value) {
+					err = fmt.Errorf("memory: performing an update on the path '_id' would modify the immutable field '_id'")
+					return
+				}
+			}
+
+			parts := split(field.Key)
+			if current, err = applyOperator(current, op.Key, parts, field.Value, inserting); err != nil {
+				return
+			}
+		}
+	}
+
+	result = current.(bson.D)
+	return
+}
+
+func applyOperator(doc any, operator string, parts []string, value any, inserting bool) (any, error) {
+	old, found := getPath(doc, parts)
+
+	switch operator {
+	case "$set":
+		return set(doc, parts, value)
+	case "$setOnInsert":
+		if !inserting {
+			return doc, nil
+		}
+		return set(doc, parts, value)
+	case "$unset":
+		return unsetPath(doc, parts), nil
+	case "$inc", "$mul":
+		if found && old != nil {
+			if _, ok := toFloat(old); !ok {
+				return doc, fmt.Errorf("memory: cannot apply %s to a non-numeric value", operator)
+			}
+		}
+		if _, ok := toFloat(value); !ok {
+			return doc, fmt.Errorf("memory: %s needs a number", operator)
+		}
+		if !found || old == nil {
+			if operator == "$mul" {
+				return set(doc, parts, arithmetic(zeroOf(value), value, operator))
+			}
+			return set(doc, parts, value)
+		}
+		return set(doc, parts, arithmetic(old, value, operator))
+	case "$min":
+		if !found || compare(value, old) < 0 {
+			return set(doc, parts, value)
+		}
+		return doc, nil
+	case "$max":
+		if !found || compare(value, old) > 0 {
+			return set(doc, parts, value)
+		}
+		return doc, nil
+	case "$currentDate":
+		return set(doc, parts, primitive.NewDateTimeFromTime(time.Now()))
+	case "$rename":
+		to, ok := value.(string)
+		if !ok {
+			return doc, fmt.Errorf("memory: $rename needs a string")
+		}
+		if !found {
+			return doc, nil
+		}
+		return set(unsetPath(doc, parts), split(to), old)
+	case "$push", "$addToSet":
+		arr, err := arrayAt(old, found, operator)
+		if err != nil {
+			return doc, err
+		}
+		items := bson.A{value}
+		if each, ok := value.(bson.D); ok {
+			if list, ok := get(each, "$each"); ok {
+				if items, ok = list.(bson.A); !ok {
+					return doc, fmt.Errorf("memory: $each needs an array")
+				}
+			}
+		}
+		for _, item := range items {
+			if operator == "$addToSet" && contains(arr, item) {
+				continue
+			}
+			arr = append(arr, item)
+		}
+		return set(doc, parts, arr)
+	case "$pull", "$pullAll":
+		if !found {
+			return doc, nil
+		}
+		arr, err := arrayAt(old, found, operator)
+		if err != nil {
+			return doc, err
+		}
+		kept := bson.A{}
+		for _, item := range arr {
+			remove, err := pulled(item, value, operator)
+			if err != nil {
+				return doc, err
+			}
+			if !remove {
+				kept = append(kept, item)
+			}
+		}
+		return set(doc, parts, kept)
+	case "$pop":
+		if !found {
+			return doc, nil
+		}
+		arr, err := arrayAt(old, found, operator)
+		if err != nil || len(arr) == 0 {
+			return doc, err
+		}
+		if direction, _ := toFloat(value); direction < 0 {
+			return set(doc, parts, arr[1:])
+		}
+		return set(doc, parts, arr[:len(arr)-1])
+	}
+	return doc, fmt.Errorf("memory: unsupported update operator %s", operator)
+}
+
+func set(doc any, parts []string, value any) (any, error) {
+	result, ok := setPath(doc, parts, value)
+	if !ok {
+		return doc, fmt.Errorf("memory: cannot create field %s", strings.Join(parts, "."))
+	}
+	return result, nil
+}
+
+func arrayAt(value any, found bool, operator string) (bson.A, error) {
+	if !found || value == nil {
+		return bson.A{}, nil
+	}
+	arr, ok := value.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("memory: %s needs an array field", operator)
+	}
+	return append(bson.A{}, arr...), nil
+}
+
+func contains(arr bson.A, value any) bool {
+	for _, item := range arr {
+		if equal(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func pulled(item any, cond any, operator string) (bool, error) {
+	if operator == "$pullAll" {
+		list, ok := cond.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("memory: $pullAll needs an array")
+		}
+		return contains(list, item), nil
+	}
+	if doc, ok := cond.(bson.D); ok {
+		if _, isDoc := item.(bson.D); isDoc || isOperatorDoc(doc) {
+			return matchElem(item, doc)
+		}
+	}
+	return equal(item, cond), nil
+}
+
+func zeroOf(value any) any {
+	switch value.(type) {
+	case int32:
+		return int32(0)
+	case int64:
+		return int64(0)
+	}
+	return float64(0)
+}
+
+// arithmetic keep integer type like mongodb, int32 overflow is promoted to int64
+func arithmetic(a, b any, operator string) any {
+	switch va := a.(type) {
+	case int32:
+		switch vb := b.(type) {
+		case int32:
+			r := calc(int64(va), int64(vb), operator)
+			if r >= math.MinInt32 && r <= math.MaxInt32 {
+				return int32(r)
+			}
+			return r
+		case int64:
+			return calc(int64(va), vb, operator)
+		}
+	case int64:
+		switch vb := b.(type) {
+		case int32:
+			return calc(va, int64(vb), operator)
+		case int64:
+			return calc(va, vb, operator)
+		}
+	}
+
+	fa, _ := toFloat(a)
+	fb, _ := toFloat(b)
+	if operator == "$mul" {
+		return fa * fb
+	}
+	return fa + fb
+}
+
+func calc(a, b int64, operator string) int64 {
+	if operator == "$mul" {
+		return a * b
+	}
+	return a + b
+}
+
+// replace build the replacement of doc, _id of doc is kept and cannot be changed
+func replace(doc bson.D, replacement bson.D) (result bson.D, err error) {
+	id, found := get(doc, "_id")
+	result = bson.D{}
+	if found {
+		result = append(result, bson.E{Key: "_id", Value: id})
+	}
+
+	for _, field := range replacement {
+		if field.Key != "_id" {
+			result = append(result, field)
+			continue
+		}
+		if !found {
+			result = append(bson.D{field}, result...)
+		} else if !equal(id, field.Value) {
+			err = fmt.Errorf("memory: the (immutable) field '_id' was found to have been altered")
+			return
+		}
+	}
+	return
+}
+
+// upsertDoc build the document inserted by an upsert from equality conditions of filter
+func upsertDoc(filter bson.D) bson.D {
+	var doc any = bson.D{}
+	for _, e := range filter {
+		switch {
+		case e.Key == "$and":
+			list, _ := e.Value.(bson.A)
+			for _, item := range list {
+				if sub, ok := item.(bson.D); ok {
+					for _, se := range upsertDoc(sub) {
+						doc, _ = setPath(doc, []string{se.Key}, se.Value)
+					}
+				}
+			}
+		case strings.HasPrefix(e.Key, "$"):
+		case isOperatorDoc(e.Value):
+			if eq, ok := get(e.Value.(bson.D), "$eq"); ok {
+				doc, _ = setPath(doc, split(e.Key), eq)
+			}
+		default:
+			doc, _ = setPath(doc, split(e.Key), e.Value)
+		}
+	}
+	return doc.(bson.D)
+}
@@ -0,0 +1,316 @@
+package memory
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// toDoc normalize any document (struct, bson.M, mgo bson.M, bson.D ...) to bson.D,
+// nested documents become bson.D and arrays become bson.A
+func toDoc(value any) (doc bson.D, err error) {
+	doc = bson.D{}
+	if value == nil {
+		return
+	}
+
+	raw, err := bson.Marshal(value)
+	if err != nil {
+		return
+	}
+	err = bson.Unmarshal(raw, &doc)
+	return
+}
+
+// toValue normalize any value the same way as a field of toDoc
+func toValue(value any) (any, error) {
+	doc, err := toDoc(bson.D{{Key: "v", Value: value}})
+	if err != nil {
+		return nil, err
+	}
+	return doc[0].Value, nil
+}
+
+func get(doc bson.D, key string) (any, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+func split(path string) []string {
+	return strings.Split(path, ".")
+}
+
+// resolve get candidate values of path, arrays of documents are traversed like mongodb does
+func resolve(value any, parts []string) []any {
+	if len(parts) == 0 {
+		return []any{value}
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		child, ok := get(v, parts[0])
+		if !ok {
+			return nil
+		}
+		return resolve(child, parts[1:])
+	case bson.A:
+		if index, err := strconv.Atoi(parts[0]); err == nil {
+			if index >= 0 && index < len(v) {
+				return resolve(v[index], parts[1:])
+			}
+			return nil
+		}
+		values := []any{}
+		for _, item := range v {
+			if _, ok := item.(bson.D); ok {
+				values = append(values, resolve(item, parts)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// getPath get value of path without traversing arrays of documents
+func getPath(value any, parts []string) (any, bool) {
+	if len(parts) == 0 {
+		return value, true
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		child, ok := get(v, parts[0])
+		if !ok {
+			return nil, false
+		}
+		return getPath(child, parts[1:])
+	case bson.A:
+		index, err := strconv.Atoi(parts[0])
+		if err != nil || index < 0 || index >= len(v) {
+			return nil, false
+		}
+		return getPath(v[index], parts[1:])
+	}
+	return nil, false
+}
+
+// setPath set value of path, missing documents on the path are created
+func setPath(value any, parts []string, newValue any) (any, bool) {
+	if len(parts) == 0 {
+		return newValue, true
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		doc := append(bson.D{}, v...)
+		for i, e := range doc {
+			if e.Key == parts[0] {
+				child, ok := setPath(e.Value, parts[1:], newValue)
+				if !ok {
+					return value, false
+				}
+				doc[i].Value = child
+				return doc, true
+			}
+		}
+		child, ok := setPath(bson.D{}, parts[1:], newValue)
+		if !ok {
+			return value, false
+		}
+		return append(doc, bson.E{Key: parts[0], Value: child}), true
+	case bson.A:
+		index, err := strconv.Atoi(parts[0])
+		if err != nil || index < 0 {
+			return value, false
+		}
+		arr := append(bson.A{}, v...)
+		for len(arr) <= index {
+			arr = append(arr, nil)
+		}
+		child, ok := setPath(arr[index], parts[1:], newValue)
+		if !ok {
+			return value, false
+		}
+		arr[index] = child
+		return arr, true
+	}
+	return value, false
+}
+
+// unsetPath remove field of path
+func unsetPath(value any, parts []string) any {
+	if len(parts) == 0 {
+		return value
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		doc := bson.D{}
+		for _, e := range v {
+			if e.Key != parts[0] {
+				doc = append(doc, e)
+			} else if len(parts) > 1 {
+				doc = append(doc, bson.E{Key: e.Key, Value: unsetPath(e.Value, parts[1:])})
+			}
+		}
+		return doc
+	case bson.A:
+		index, err := strconv.Atoi(parts[0])
+		if err != nil || index < 0 || index >= len(v) {
+			return value
+		}
+		arr := append(bson.A{}, v...)
+		if len(parts) == 1 {
+			arr[index] = nil
+		} else {
+			arr[index] = unsetPath(arr[index], parts[1:])
+		}
+		return arr
+	}
+	return value
+}
+
+// typeRank is the bson comparison order of mongodb
+func typeRank(value any) int {
+	switch value.(type) {
+	case primitive.MinKey:
+		return 0
+	case nil, primitive.Undefined, primitive.Null:
+		return 1
+	case int32, int64, float64, primitive.Decimal128:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.D:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	case primitive.MaxKey:
+		return 13
+	}
+	return 12
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compare two normalized values by bson comparison order
+func compare(a, b any) int {
+	rankA, rankB := typeRank(a), typeRank(b)
+	if rankA != rankB {
+		return rankA - rankB
+	}
+
+	switch va := a.(type) {
+	case int32, int64, float64, primitive.Decimal128:
+		fa, _ := toFloat(va)
+		fb, _ := toFloat(b)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		case math.IsNaN(fa) && !math.IsNaN(fb):
+			return -1
+		}
+		return 0
+	case string:
+		return strings.Compare(va, stringOf(b))
+	case primitive.Symbol:
+		return strings.Compare(string(va), stringOf(b))
+	case bson.D:
+		vb := b.(bson.D)
+		for i := 0; i < len(va) && i < len(vb); i++ {
+			if c := strings.Compare(va[i].Key, vb[i].Key); c != 0 {
+				return c
+			}
+			if c := compare(va[i].Value, vb[i].Value); c != 0 {
+				return c
+			}
+		}
+		return len(va) - len(vb)
+	case bson.A:
+		vb := b.(bson.A)
+		for i := 0; i < len(va) && i < len(vb); i++ {
+			if c := compare(va[i], vb[i]); c != 0 {
+				return c
+			}
+		}
+		return len(va) - len(vb)
+	case primitive.Binary:
+		return bytes.Compare(va.Data, b.(primitive.Binary).Data)
+	case primitive.ObjectID:
+		vb := b.(primitive.ObjectID)
+		return bytes.Compare(va[:], vb[:])
+	case bool:
+		vb := b.(bool)
+		switch {
+		case va == vb:
+			return 0
+		case !va:
+			return -1
+		}
+		return 1
+	case primitive.DateTime:
+		vb := b.(primitive.DateTime)
+		switch {
+		case va < vb:
+			return -1
+		case va > vb:
+			return 1
+		}
+		return 0
+	case primitive.Timestamp:
+		return primitive.CompareTimestamp(va, b.(primitive.Timestamp))
+	case primitive.Regex:
+		vb := b.(primitive.Regex)
+		return strings.Compare(va.Pattern+"/"+va.Options, vb.Pattern+"/"+vb.Options)
+	}
+	return 0
+}
+
+func stringOf(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case primitive.Symbol:
+		return string(v)
+	}
+	return ""
+}
+
+func equal(a, b any) bool {
+	return typeRank(a) == typeRank(b) && compare(a, b) == 0
+}
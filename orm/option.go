@@ -0,0 +1,101 @@
+package orm
+
+// Option configure an eloquent instance created by NewEloquent
+type Option func(*settings)
+
+type settings struct {
+	// index declared by WithIndexes
+	indexes []IndexSpec
+	// error of index declared by model tags, returned by EnsureIndexes
+	indexErr error
+	// timestamp fields set by WithTimestamps
+	timestamps timestampSettings
+	// enabled by WithSoftDeletes
+	softDeletes bool
+	// connection name set by OnConnection
+	connection string
+	// db name set by OnDatabase, empty to use db of connection config
+	database string
+	// storage set by WithCollection, nil to use mongodb
+	collection Collection
+	// page size of PaginateRequest set by WithPerPage
+	perPage    int
+	maxPerPage int
+	// scheme of PaginateRequest links is read from X-Forwarded-Proto, set by WithForwardedProto
+	forwardedProto bool
+	// relations registered by DefineRelation, shared by copies of eloquent
+	relations map[string]Relation
+	// _id strategy set by WithIDStrategy
+	idStrategy IDStrategy
+	// collection of sequences set by WithCounters, nil to use mongodb
+	counters Collection
+}
+
+func newSettings(opts ...Option) settings {
+	s := settings{
+		connection: DefaultConnection,
+		perPage:    10,
+		maxPerPage: 100,
+		relations:  map[string]Relation{},
+		idStrategy: ObjectIDStrategy(),
+		timestamps: timestampSettings{
+			createdAt: "created_at",
+			updatedAt: "updated_at",
+			format:    TimestampAuto,
+		},
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+/**
+ * @title declare indexes of collection, create them by EnsureIndexes
+ * @param specs ...IndexSpec ex: orm.Index("email").Unique(), orm.Index("created_at").TTL(3600)
+ */
+func WithIndexes(specs ...IndexSpec) Option {
+	return func(s *settings) {
+		s.indexes = append(s.indexes, specs...)
+	}
+}
+
+/**
+ * @title bind eloquent to a connection registered by AddConnection. default is DefaultConnection
+ */
+func OnConnection(name string) Option {
+	return func(s *settings) {
+		s.connection = name
+	}
+}
+
+/**
+ * @title use another db instead of the db of connection config
+ */
+func OnDatabase(db string) Option {
+	return func(s *settings) {
+		s.database = db
+	}
+}
+
+/**
+ * @title page size of PaginateRequest. default=10, max=100
+ * @param perPage int used when per_page query parameter is missing
+ * @param maxPerPage int per_page query parameter is capped to it, 0 means no cap
+ */
+func WithPerPage(perPage int, maxPerPage int) Option {
+	return func(s *settings) {
+		s.perPage = perPage
+		s.maxPerPage = maxPerPage
+	}
+}
+
+/**
+ * @title read scheme of PaginateRequest links from X-Forwarded-Proto header.
+ * enable it only behind a proxy which sets the header, clients can send any value
+ */
+func WithForwardedProto() Option {
+	return func(s *settings) {
+		s.forwardedProto = true
+	}
+}
@@ -1,5 +1,20 @@
 package orm
 
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// query parameters read by PaginateRequest
+const (
+	PageParam    = "page"
+	PerPageParam = "per_page"
+)
+
 type Pagination[T any] struct {
 	Total       int  `json:"total"`
 	PerPage     int  `json:"per_page"`
@@ -8,6 +23,12 @@ type Pagination[T any] struct {
 	From        int  `json:"from"`
 	To          int  `json:"to"`
 	Data        []*T `json:"data"`
+	// links are filled by PaginateRequest or SetLinks, nil (null in json) means no such page
+	Path         *string `json:"path"`
+	FirstPageURL *string `json:"first_page_url"`
+	LastPageURL  *string `json:"last_page_url"`
+	NextPageURL  *string `json:"next_page_url"`
+	PrevPageURL  *string `json:"prev_page_url"`
 }
 
 func newPagination[T any](total int, limit int, page int, lastPage int, from int, to int, data []*T) *Pagination[T] {
@@ -21,3 +42,116 @@ func newPagination[T any](total int, limit int, page int, lastPage int, from int
 		Data:        data,
 	}
 }
+
+// SimplePagination is the result of SimplePaginate, total and last page are not counted
+type SimplePagination[T any] struct {
+	PerPage     int  `json:"per_page"`
+	CurrentPage int  `json:"current_page"`
+	From        int  `json:"from"`
+	To          int  `json:"to"`
+	HasMore     bool `json:"has_more"`
+	Data        []*T `json:"data"`
+}
+
+func newSimplePagination[T any](limit int, page int, from int, to int, hasMore bool, data []*T) *SimplePagination[T] {
+	return &SimplePagination[T]{
+		PerPage:     limit,
+		CurrentPage: page,
+		From:        from,
+		To:          to,
+		HasMore:     hasMore,
+		Data:        data,
+	}
+}
+
+/**
+ * @title fill link fields by the url of current page, other query parameters are kept. user info of u is not copied
+ * @param u *url.URL absolute url of request, ex: https://example.com/users?name=neil&page=2
+ */
+func (p *Pagination[T]) SetLinks(u *url.URL) {
+	path := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+	p.Path = &path
+
+	pageURL := func(page int) *string {
+		query := u.Query()
+		query.Set(PageParam, strconv.Itoa(page))
+		query.Set(PerPageParam, strconv.Itoa(p.PerPage))
+		link := path + "?" + query.Encode()
+		return &link
+	}
+
+	lastPage := p.LastPage
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	p.FirstPageURL = pageURL(1)
+	p.LastPageURL = pageURL(lastPage)
+	p.NextPageURL = nil
+	p.PrevPageURL = nil
+	if p.CurrentPage < p.LastPage {
+		p.NextPageURL = pageURL(p.CurrentPage + 1)
+	}
+	if p.CurrentPage > lastPage {
+		p.PrevPageURL = pageURL(lastPage)
+	} else if p.CurrentPage > 1 {
+		p.PrevPageURL = pageURL(p.CurrentPage - 1)
+	}
+}
+
+/**
+ * @title read page and per_page query parameters of request
+ * @param defaultPerPage int used when per_page is missing or invalid
+ * @param maxPerPage int per_page is capped to it, 0 means no cap
+ */
+func BindPage(r *http.Request, defaultPerPage int, maxPerPage int) (page int, perPage int) {
+	query := r.URL.Query()
+
+	page, errP := strconv.Atoi(query.Get(PageParam))
+	if errP != nil || page < 1 {
+		page = 1
+	}
+
+	perPage, errPP := strconv.Atoi(query.Get(PerPageParam))
+	if errPP != nil || perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if maxPerPage > 0 && perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	return
+}
+
+// requestURL rebuild absolute url of request, X-Forwarded-Proto is only read if forwardedProto
+func requestURL(r *http.Request, forwardedProto bool) *url.URL {
+	u := *r.URL
+	u.User = nil
+	if u.Host == "" {
+		u.Host = r.Host
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+		if r.TLS != nil {
+			u.Scheme = "https"
+		} else if proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); forwardedProto && (proto == "http" || proto == "https") {
+			u.Scheme = proto
+		}
+	}
+	return &u
+}
+
+/**
+ * @title bind page and per_page from request, run Paginate and fill link fields. per page size is set by WithPerPage,
+ * X-Forwarded-Proto is trusted if WithForwardedProto is set
+ * @param r *http.Request its context is used for the query
+ */
+func (e *Eloquent[T]) PaginateRequest(r *http.Request, filter any, opts ...*options.FindOptions) (paginated *Pagination[T], err error) {
+	page, perPage := BindPage(r, e.settings.perPage, e.settings.maxPerPage)
+
+	paginated, err = e.Paginate(r.Context(), perPage, page, filter, opts...)
+	if err != nil {
+		return
+	}
+	paginated.SetLinks(requestURL(r, e.settings.forwardedProto))
+	return
+}
@@ -0,0 +1,343 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Relation is a relationship between two eloquent models, create it by HasOne, HasMany, BelongsTo or BelongsToMany
+// and register it by DefineRelation. it is eager loaded by With into the model field of the same name
+type Relation interface {
+	// Name is the relation name, ex: orders
+	Name() string
+	// eagerLoad fill relation field of parents, parents is []*T
+	eagerLoad(ctx context.Context, parents reflect.Value, nested []string) error
+}
+
+type relationKind int
+
+const (
+	hasOne relationKind = iota
+	hasMany
+	belongsTo
+	belongsToMany
+)
+
+type relation[R any] struct {
+	name    string
+	kind    relationKind
+	related IEloquent[R]
+	// key of parent document, ex: _id of users for HasMany, user_id of orders for BelongsTo
+	parentKey string
+	// key of related document, ex: user_id of orders for HasMany, _id of users for BelongsTo
+	relatedKey string
+}
+
+func (r *relation[R]) Name() string {
+	return r.name
+}
+
+func optionalKey(keys []string) string {
+	if len(keys) > 0 && keys[0] != "" {
+		return keys[0]
+	}
+	return "_id"
+}
+
+/**
+ * @title parent has one related document, ex: user has one profile
+ * @param name string relation name, loaded into the model field of the same name (case insensitive) ex: Profile *Profile `bson:"-"`
+ * @param related IEloquent[R] eloquent of related model
+ * @param foreignKey string field of related document referring to parent, ex: user_id
+ * @param localKey ...string field of parent document referred by foreignKey. default=_id
+ */
+func HasOne[R any](name string, related IEloquent[R], foreignKey string, localKey ...string) Relation {
+	return &relation[R]{name: name, kind: hasOne, related: related, parentKey: optionalKey(localKey), relatedKey: foreignKey}
+}
+
+/**
+ * @title parent has many related documents, ex: user has many orders
+ * @param name string relation name, loaded into the model field of the same name (case insensitive) ex: Orders []*Order `bson:"-"`
+ * @param related IEloquent[R] eloquent of related model
+ * @param foreignKey string field of related document referring to parent, ex: user_id
+ * @param localKey ...string field of parent document referred by foreignKey. default=_id
+ */
+func HasMany[R any](name string, related IEloquent[R], foreignKey string, localKey ...string) Relation {
+	return &relation[R]{name: name, kind: hasMany, related: related, parentKey: optionalKey(localKey), relatedKey: foreignKey}
+}
+
+/**
+ * @title parent refers to one related document, ex: order belongs to user
+ * @param name string relation name, loaded into the model field of the same name (case insensitive) ex: User *User `bson:"-"`
+ * @param related IEloquent[R] eloquent of related model
+ * @param foreignKey string field of parent document referring to related, ex: user_id
+ * @param ownerKey ...string field of related document referred by foreignKey. default=_id
+ */
+func BelongsTo[R any](name string, related IEloquent[R], foreignKey string, ownerKey ...string) Relation {
+	return &relation[R]{name: name, kind: belongsTo, related: related, parentKey: foreignKey, relatedKey: optionalKey(ownerKey)}
+}
+
+func (r *relation[R]) eagerLoad(ctx context.Context, parents reflect.Value, nested []string) (err error) {
+	if parents.Len() == 0 {
+		return
+	}
+
+	field, err := relationField(parents.Type().Elem().Elem(), r.name)
+	if err != nil {
+		return
+	}
+
+	keys := relationKeys{}
+	parentKeys := make([][]string, parents.Len())
+	for i := 0; i < parents.Len(); i++ {
+		if parentKeys[i], err = keys.add(parents.Index(i).Interface(), r.parentKey); err != nil {
+			return
+		}
+	}
+
+	byKey := map[string][]*R{}
+	if len(keys.values) > 0 {
+		related := r.related
+		if len(nested) > 0 {
+			related = related.With(nested...)
+		}
+
+		models, errF := related.FindMultiple(ctx, bson.M{r.relatedKey: bson.M{"$in": keys.values}})
+		if errF != nil {
+			err = errF
+			return
+		}
+
+		for _, model := range models {
+			modelKeys, errK := (&relationKeys{}).add(model, r.relatedKey)
+			if errK != nil {
+				err = errK
+				return
+			}
+			for _, key := range modelKeys {
+				byKey[key] = append(byKey[key], model)
+			}
+		}
+	}
+
+	for i := 0; i < parents.Len(); i++ {
+		matched := []*R{}
+		seen := map[*R]bool{}
+		for _, key := range parentKeys[i] {
+			for _, model := range byKey[key] {
+				if !seen[model] {
+					seen[model] = true
+					matched = append(matched, model)
+				}
+			}
+		}
+
+		target := parents.Index(i).Elem().FieldByIndex(field.Index)
+		if r.kind == hasMany || r.kind == belongsToMany {
+			assignMany(target, matched)
+		} else if len(matched) > 0 {
+			assignOne(target, matched[0])
+		} else {
+			target.Set(reflect.Zero(target.Type()))
+		}
+	}
+	return
+}
+
+// relationField find the struct field of relation by name, case and underscore insensitive
+func relationField(model reflect.Type, name string) (field reflect.StructField, err error) {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, "_", ""))
+	}
+
+	for i := 0; i < model.NumField(); i++ {
+		if normalize(model.Field(i).Name) == normalize(name) {
+			field = model.Field(i)
+			return
+		}
+	}
+	err = fmt.Errorf("%w: model %s has no field for relation %q", ErrInvalidConfig, model.Name(), name)
+	return
+}
+
+// assignMany set []*R or []R field
+func assignMany[R any](target reflect.Value, models []*R) {
+	if target.Type() == reflect.TypeOf(models) {
+		target.Set(reflect.ValueOf(models))
+		return
+	}
+
+	values := reflect.MakeSlice(target.Type(), 0, len(models))
+	for _, model := range models {
+		values = reflect.Append(values, reflect.ValueOf(model).Elem())
+	}
+	target.Set(values)
+}
+
+// assignOne set *R or R field
+func assignOne[R any](target reflect.Value, model *R) {
+	if target.Kind() == reflect.Pointer {
+		target.Set(reflect.ValueOf(model))
+		return
+	}
+	target.Set(reflect.ValueOf(model).Elem())
+}
+
+// relationKeys collect key values of documents for $in query.
+// ObjectID and its hex string are treated as the same key, so string ID of model matches ObjectID stored in mongodb
+type relationKeys struct {
+	values []any
+	seen   map[string]bool
+}
+
+// add read key of model, elements of array key are separate keys
+func (k *relationKeys) add(model any, key string) (canonical []string, err error) {
+	raw, err := bson.Marshal(model)
+	if err != nil {
+		return
+	}
+
+	value, errL := bson.Raw(raw).LookupErr(strings.Split(key, ".")...)
+	if errL != nil {
+		return
+	}
+
+	values := []bson.RawValue{value}
+	if value.Type == bsontype.Array {
+		elements, errA := value.Array().Values()
+		if errA != nil {
+			err = errA
+			return
+		}
+		values = elements
+	}
+
+	for _, element := range values {
+		if element.Type == bsontype.Null || element.Type == bsontype.Undefined {
+			continue
+		}
+
+		var decoded any
+		if err = element.Unmarshal(&decoded); err != nil {
+			return
+		}
+
+		id, isID := decoded.(primitive.ObjectID)
+		hex, isString := decoded.(string)
+		switch {
+		case isID:
+			canonical = append(canonical, id.Hex())
+			k.push(id.Hex(), id, id.Hex())
+		case isString && primitive.IsValidObjectID(hex):
+			id, _ = primitive.ObjectIDFromHex(hex)
+			canonical = append(canonical, hex)
+			k.push(hex, id, hex)
+		default:
+			text := numericKey(decoded)
+			if text == "" {
+				text = element.String()
+			}
+			canonical = append(canonical, text)
+			k.push(text, decoded)
+		}
+	}
+	return
+}
+
+// numericKey format integral numbers of any bson width the same, so int32 foreign key matches int64 _id.
+// empty for other values
+func numericKey(value any) string {
+	switch number := value.(type) {
+	case int32:
+		return "number:" + strconv.FormatInt(int64(number), 10)
+	case int64:
+		return "number:" + strconv.FormatInt(number, 10)
+	case float64:
+		if number == math.Trunc(number) && math.Abs(number) < 1<<53 {
+			return "number:" + strconv.FormatInt(int64(number), 10)
+		}
+		return "number:" + strconv.FormatFloat(number, 'g', -1, 64)
+	}
+	return ""
+}
+
+func (k *relationKeys) push(canonical string, values ...any) {
+	if k.seen == nil {
+		k.seen = map[string]bool{}
+	}
+	if k.seen[canonical] {
+		return
+	}
+	k.seen[canonical] = true
+	k.values = append(k.values, values...)
+}
+
+/**
+ * @title register relations, they can refer to each other after every eloquent is created
+ * @example userOrm.DefineRelation(orm.HasMany[Order]("orders", orderOrm, "user_id"))
+ */
+func (e *Eloquent[T]) DefineRelation(relations ...Relation) {
+	for _, r := range relations {
+		e.settings.relations[r.Name()] = r
+	}
+}
+
+/**
+ * @title eager load relations in the following queries, one query per relation
+ * @param relations ...string relation name registered by DefineRelation, nested relation is separated by dot. ex: With("orders", "orders.items")
+ * @return eloquent IEloquent[T] a copy of eloquent
+ */
+func (e *Eloquent[T]) With(relations ...string) IEloquent[T] {
+	clone := *e
+	clone.eager = append(append([]string{}, e.eager...), relations...)
+	return &clone
+}
+
+// eagerLoad load relations of With into models
+func (e *Eloquent[T]) eagerLoad(ctx context.Context, models []*T) (err error) {
+	if len(e.eager) == 0 || len(models) == 0 {
+		return
+	}
+
+	names := []string{}
+	nested := map[string][]string{}
+	for _, path := range e.eager {
+		name, rest, _ := strings.Cut(path, ".")
+		if _, ok := nested[name]; !ok {
+			names = append(names, name)
+			nested[name] = []string{}
+		}
+		if rest != "" {
+			nested[name] = append(nested[name], rest)
+		}
+	}
+
+	for _, name := range names {
+		r, ok := e.settings.relations[name]
+		if !ok {
+			err = fmt.Errorf("%w: relation %q is not defined", ErrInvalidConfig, name)
+			return
+		}
+		if err = r.eagerLoad(ctx, reflect.ValueOf(models), nested[name]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// afterFind eager load relations, then call AfterFind hooks
+func (e *Eloquent[T]) afterFind(ctx context.Context, models ...*T) (err error) {
+	if err = e.eagerLoad(ctx, models); err != nil {
+		return
+	}
+	err = afterFind(ctx, models...)
+	return
+}
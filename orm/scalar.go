@@ -0,0 +1,205 @@
+package orm
+
+import (
+	"context"
+	"strings"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// scalarResult is the document of a single value aggregation
+type scalarResult[V any] struct {
+	Value V `bson:"value"`
+}
+
+// scalar group matched documents into one value by accumulator, ex: $sum
+func scalar[V any, T any](ctx context.Context, e *Eloquent[T], operation string, accumulator string, field string, filter any) (value V, err error) {
+	coll, errConn := e.collection(operation)
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	pipeline := NewPipeline()
+	if query := e.scope(filter); !isEmptyFilter(query) {
+		pipeline.Match(query)
+	}
+	pipeline.Group(nil, map[string]any{"value": bson.M{accumulator: "$" + strings.TrimPrefix(field, "$")}})
+
+	cursor, errA := coll.Aggregate(ctx, pipeline.Stages())
+	if errA != nil {
+		logger.LogDebug.Error(e.logTitle, errA, getCurrentFuncInfo(2))
+		err = e.errMsg(operation, errA)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		if errC := cursor.Err(); errC != nil {
+			logger.LogDebug.Error(e.logTitle, errC, getCurrentFuncInfo(2))
+			err = e.errMsg(operation, errC)
+		}
+		return
+	}
+
+	result := scalarResult[V]{}
+	if errD := cursor.Decode(&result); errD != nil {
+		logger.LogDebug.Error(e.logTitle, errD, getCurrentFuncInfo(2))
+		err = e.errMsg(operation, errD)
+		return
+	}
+	value = result.Value
+	return
+}
+
+/**
+ * @title sum of a numeric field, non-numeric values are ignored
+ * @param field string field name, ex: age
+ * @param filter any query condition, nil for all documents
+ * @return sum float64 0 if no document matched
+ */
+func (e *Eloquent[T]) Sum(ctx context.Context, field string, filter any) (sum float64, err error) {
+	sum, err = scalar[float64](ctx, e, "Sum", "$sum", field, filter)
+	return
+}
+
+/**
+ * @title average of a numeric field, non-numeric values are ignored
+ * @return avg float64 0 if no document matched
+ */
+func (e *Eloquent[T]) Avg(ctx context.Context, field string, filter any) (avg float64, err error) {
+	avg, err = scalar[float64](ctx, e, "Avg", "$avg", field, filter)
+	return
+}
+
+/**
+ * @title minimum value of a field, null and missing values are ignored
+ * @return min any int32, int64, float64, string, primitive.DateTime ..., nil if no document matched
+ */
+func (e *Eloquent[T]) Min(ctx context.Context, field string, filter any) (min any, err error) {
+	min, err = scalar[any](ctx, e, "Min", "$min", field, filter)
+	return
+}
+
+/**
+ * @title maximum value of a field, null and missing values are ignored
+ * @return max any int32, int64, float64, string, primitive.DateTime ..., nil if no document matched
+ */
+func (e *Eloquent[T]) Max(ctx context.Context, field string, filter any) (max any, err error) {
+	max, err = scalar[any](ctx, e, "Max", "$max", field, filter)
+	return
+}
+
+/**
+ * @title distinct values of a field, elements of array field are counted separately
+ * @param field string field name, ex: age
+ * @param filter any query condition, nil for all documents
+ * @return values []any convert them by ValuesAs
+ */
+func (e *Eloquent[T]) Distinct(ctx context.Context, field string, filter any) (values []any, err error) {
+	coll, errConn := e.collection("Distinct")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	query := e.scope(filter)
+	if query == nil {
+		query = bson.M{}
+	}
+
+	values, errD := coll.Distinct(ctx, field, query)
+	if errD != nil {
+		logger.LogDebug.Error(e.logTitle, errD, getCurrentFuncInfo(1))
+		err = e.errMsg("Distinct", errD)
+		return
+	}
+	return
+}
+
+/**
+ * @title values of a field of matched documents, nil for documents without the field
+ * @param field string field name, ex: name or profile.email
+ * @param filter any query condition, nil for all documents
+ * @param opts ...*options.FindOptions sort, limit ...
+ * @return values []any convert them by ValuesAs
+ */
+func (e *Eloquent[T]) Pluck(ctx context.Context, field string, filter any, opts ...*options.FindOptions) (values []any, err error) {
+	coll, errConn := e.collection("Pluck")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	projection := bson.M{field: 1}
+	if field != "_id" {
+		projection["_id"] = 0
+	}
+	opts = append(opts, options.Find().SetProjection(projection))
+
+	cursor, errF := coll.Find(ctx, e.scope(filter), opts...)
+	if errF != nil {
+		logger.LogDebug.Error(e.logTitle, errF, getCurrentFuncInfo(1))
+		err = e.errMsg("Pluck", errF)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	values = []any{}
+	keys := strings.Split(field, ".")
+	for cursor.Next(ctx) {
+		raw, errL := cursor.Current.LookupErr(keys...)
+		if errL != nil {
+			values = append(values, nil)
+			continue
+		}
+
+		var value any
+		if errU := raw.Unmarshal(&value); errU != nil {
+			logger.LogDebug.Error(e.logTitle, errU, getCurrentFuncInfo(1))
+			err = e.errMsg("Pluck", errU)
+			return
+		}
+		values = append(values, value)
+	}
+
+	if errC := cursor.Err(); errC != nil {
+		logger.LogDebug.Error(e.logTitle, errC, getCurrentFuncInfo(1))
+		err = e.errMsg("Pluck", errC)
+		return
+	}
+	return
+}
+
+/**
+ * @title convert values of Distinct or Pluck to V by bson decoding, ex: int32 to int, ObjectID to string
+ * @example names, err := orm.ValuesAs[string](userOrm.Distinct(ctx, "name", nil))
+ * @return typed []V
+ * @return err error err passed in, or decoding error
+ */
+func ValuesAs[V any](values []any, err error) (typed []V, errV error) {
+	if err != nil {
+		errV = err
+		return
+	}
+
+	typed = make([]V, 0, len(values))
+	for _, value := range values {
+		raw, errM := bson.Marshal(bson.D{{Key: "value", Value: value}})
+		if errM != nil {
+			errV = newError("", "ValuesAs", errM)
+			return
+		}
+
+		result := scalarResult[V]{}
+		if errU := bson.Unmarshal(raw, &result); errU != nil {
+			errV = newError("", "ValuesAs", errU)
+			return
+		}
+		typed = append(typed, result.Value)
+	}
+	return
+}
@@ -0,0 +1,180 @@
+package orm
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// field name of soft deleted time
+const deletedAtField = "deleted_at"
+
+type trashedScope int
+
+const (
+	// exclude soft deleted documents
+	withoutTrashed trashedScope = iota
+	// include soft deleted documents
+	withTrashed
+	// only soft deleted documents
+	onlyTrashed
+)
+
+// softDeletes is soft delete setting resolved from model
+type softDeletes struct {
+	enabled bool
+	// store deleted_at as integer instead of date
+	unix  bool
+	milli bool
+}
+
+/**
+ * @title Delete and DeleteMultiple set deleted_at instead of removing documents,
+ * read methods exclude soft deleted documents. it is enabled by default if model has a deleted_at field
+ */
+func WithSoftDeletes() Option {
+	return func(s *settings) {
+		s.softDeletes = true
+	}
+}
+
+func newSoftDeletes(model reflect.Type, enabled bool, format TimestampFormat) (sd softDeletes) {
+	sd.enabled = enabled
+	if model.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < model.NumField(); i++ {
+		field := model.Field(i)
+		if bsonFieldName(field) != deletedAtField {
+			continue
+		}
+
+		sd.enabled = true
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		switch fieldType.Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+			sd.unix = true
+			sd.milli = format == TimestampUnixMilli
+		}
+	}
+	return
+}
+
+// deletedAt is the value stored to deleted_at
+func (sd softDeletes) deletedAt() any {
+	now := time.Now()
+	switch {
+	case sd.milli:
+		return now.UnixMilli()
+	case sd.unix:
+		return now.Unix()
+	}
+	return primitive.NewDateTimeFromTime(now)
+}
+
+// scope add soft delete condition to filter
+func (e *Eloquent[T]) scope(filter any) any {
+	if !e.softDeletes.enabled || e.trashed == withTrashed {
+		return filter
+	}
+
+	var cond bson.M
+	if e.trashed == onlyTrashed {
+		cond = bson.M{deletedAtField: bson.M{"$ne": nil}}
+	} else {
+		cond = bson.M{deletedAtField: nil}
+	}
+
+	if isEmptyFilter(filter) {
+		return cond
+	}
+	return bson.M{"$and": []any{filter, cond}}
+}
+
+func isEmptyFilter(filter any) bool {
+	if filter == nil {
+		return true
+	}
+	value := reflect.ValueOf(filter)
+	switch value.Kind() {
+	case reflect.Map, reflect.Slice:
+		return value.Len() == 0
+	case reflect.Pointer:
+		return value.IsNil()
+	}
+	return false
+}
+
+/**
+ * @title include soft deleted documents in the following queries
+ * @return eloquent IEloquent[T] a copy of eloquent
+ */
+func (e *Eloquent[T]) WithTrashed() IEloquent[T] {
+	clone := *e
+	clone.trashed = withTrashed
+	return &clone
+}
+
+/**
+ * @title only query soft deleted documents in the following queries
+ * @return eloquent IEloquent[T] a copy of eloquent
+ */
+func (e *Eloquent[T]) OnlyTrashed() IEloquent[T] {
+	clone := *e
+	clone.trashed = onlyTrashed
+	return &clone
+}
+
+/**
+ * @title restore a soft deleted document
+ * @param id string _id of document
+ * @return restoredCount int restored document count
+ * @return err error fail message from query
+ */
+func (e *Eloquent[T]) Restore(ctx context.Context, id string) (restoredCount int, err error) {
+	idH, errP := e.parseID(id)
+	if errP != nil {
+		logger.LogDebug.Error(e.logTitle, "_id parse fail", getCurrentFuncInfo(1))
+		err = e.errInvalidID("Restore", errP)
+		return
+	}
+
+	coll, errConn := e.collection("Restore")
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	filter := bson.M{"_id": idH, deletedAtField: bson.M{"$ne": nil}}
+	update := bson.M{"$unset": bson.M{deletedAtField: ""}}
+
+	result, errU := coll.UpdateOne(ctx, filter, update)
+	if errU != nil {
+		logger.LogDebug.Error(e.logTitle, errU, getCurrentFuncInfo(1))
+		err = e.errMsg("Restore", errU)
+		return
+	}
+
+	restoredCount = int(result.ModifiedCount)
+	return
+}
+
+/**
+ * @title permanently delete a document, even if soft deletes is enabled
+ * @param id string _id of document
+ * @return deleteCount int delete document count
+ * @return err error fail message from query
+ */
+func (e *Eloquent[T]) ForceDelete(ctx context.Context, id string) (deleteCount int, err error) {
+	deleteCount, err = e.delete(ctx, "ForceDelete", id, true)
+	return
+}
@@ -0,0 +1,195 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TimestampFormat decide how created_at and updated_at are stored
+type TimestampFormat int
+
+const (
+	// infer from field type, time.Time and primitive.DateTime store time, integer store unix seconds
+	TimestampAuto TimestampFormat = iota
+	// unix seconds, field must be an integer
+	TimestampUnix
+	// unix milliseconds, field must be a 64 bit integer, a smaller one overflows and is rejected with ErrInvalidConfig
+	TimestampUnixMilli
+	// time.Time, field must be time.Time or primitive.DateTime
+	TimestampTime
+)
+
+// Timestamper can be implemented by model to manage its own timestamps,
+// then eloquent would call it instead of filling created_at and updated_at
+type Timestamper interface {
+	SetTimestamps(now time.Time, creating bool)
+}
+
+type timestampSettings struct {
+	disabled  bool
+	createdAt string
+	updatedAt string
+	format    TimestampFormat
+}
+
+// timestamps is timestamp fields resolved from model
+type timestamps struct {
+	createdAt []int // struct field index, nil if model has no such field
+	updatedAt []int
+	format    TimestampFormat
+}
+
+/**
+ * @title set timestamp field name and format. default is created_at, updated_at and TimestampAuto
+ * @param createdAt string bson field name of created time, empty to skip
+ * @param updatedAt string bson field name of updated time, empty to skip
+ */
+func WithTimestamps(createdAt, updatedAt string, format TimestampFormat) Option {
+	return func(s *settings) {
+		s.timestamps = timestampSettings{
+			createdAt: createdAt,
+			updatedAt: updatedAt,
+			format:    format,
+		}
+	}
+}
+
+/**
+ * @title do not fill timestamp fields
+ */
+func WithoutTimestamps() Option {
+	return func(s *settings) {
+		s.timestamps.disabled = true
+	}
+}
+
+func newTimestamps(model reflect.Type, s timestampSettings) (t timestamps) {
+	if s.disabled || model.Kind() != reflect.Struct {
+		return
+	}
+
+	t.format = s.format
+	for i := 0; i < model.NumField(); i++ {
+		name := bsonFieldName(model.Field(i))
+		if name == "" {
+			continue
+		}
+		if name == s.createdAt {
+			t.createdAt = []int{i}
+		}
+		if name == s.updatedAt {
+			t.updatedAt = []int{i}
+		}
+	}
+	return
+}
+
+/**
+ * @title fill timestamps of model. on create both fields are filled if empty, on update updated_at is always refreshed
+ * @return err error ErrInvalidConfig if the timestamp overflows the field, ex: unix milliseconds in int32
+ */
+func (t timestamps) touch(model any, creating bool) (err error) {
+	now := time.Now()
+
+	if timestamper, ok := model.(Timestamper); ok {
+		timestamper.SetTimestamps(now, creating)
+		return
+	}
+
+	value := reflect.ValueOf(model)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return
+	}
+	value = value.Elem()
+	if value.Kind() != reflect.Struct {
+		return
+	}
+
+	if creating && t.createdAt != nil {
+		field := value.FieldByIndex(t.createdAt)
+		if field.IsZero() {
+			if err = t.set(field, now); err != nil {
+				return
+			}
+		}
+	}
+
+	if t.updatedAt != nil {
+		field := value.FieldByIndex(t.updatedAt)
+		if !creating || field.IsZero() {
+			err = t.set(field, now)
+		}
+	}
+	return
+}
+
+func (t timestamps) set(field reflect.Value, now time.Time) (err error) {
+	if !field.CanSet() {
+		return
+	}
+
+	if field.Kind() == reflect.Pointer {
+		ptr := reflect.New(field.Type().Elem())
+		ok, errA := t.assign(ptr.Elem(), now)
+		if !ok {
+			err = errA
+			return
+		}
+		field.Set(ptr)
+		return
+	}
+
+	_, err = t.assign(field, now)
+	return
+}
+
+func (t timestamps) assign(field reflect.Value, now time.Time) (ok bool, err error) {
+	switch field.Interface().(type) {
+	case time.Time:
+		if t.format == TimestampUnix || t.format == TimestampUnixMilli {
+			return
+		}
+		field.Set(reflect.ValueOf(now))
+		ok = true
+		return
+	case primitive.DateTime:
+		if t.format == TimestampUnix || t.format == TimestampUnixMilli {
+			return
+		}
+		field.Set(reflect.ValueOf(primitive.NewDateTimeFromTime(now)))
+		ok = true
+		return
+	}
+
+	unix := now.Unix()
+	if t.format == TimestampUnixMilli {
+		unix = now.UnixMilli()
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if t.format == TimestampTime {
+			return
+		}
+		if field.OverflowInt(unix) {
+			err = fmt.Errorf("%w: timestamp %d overflows %s field", ErrInvalidConfig, unix, field.Type())
+			return
+		}
+		field.SetInt(unix)
+		ok = true
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		if t.format == TimestampTime {
+			return
+		}
+		if field.OverflowUint(uint64(unix)) {
+			err = fmt.Errorf("%w: timestamp %d overflows %s field", ErrInvalidConfig, unix, field.Type())
+			return
+		}
+		field.SetUint(uint64(unix))
+		ok = true
+	}
+	return
+}
@@ -0,0 +1,58 @@
+package orm
+
+import (
+	"context"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/**
+ * @title run fn in a multi-document transaction, mongodb must be a replica set or sharded cluster
+ * @param fn func(txCtx context.Context) error pass txCtx to every eloquent method inside fn to join the transaction.
+ * fn may be called more than once, the transaction is retried on transient errors. returning an error aborts the transaction
+ * @return err error fail message from fn or transaction
+ */
+func Transaction(ctx context.Context, fn func(txCtx context.Context) error, opts ...*options.TransactionOptions) (err error) {
+	err = TransactionOn(ctx, DefaultConnection, fn, opts...)
+	return
+}
+
+/**
+ * @title run fn in a multi-document transaction of a named connection, a transaction can not span connections
+ * @param name string connection name registered by AddConnection
+ */
+func TransactionOn(ctx context.Context, name string, fn func(txCtx context.Context) error, opts ...*options.TransactionOptions) (err error) {
+	client := Connection(name)
+	if client == nil {
+		err = newError("", "Transaction", ErrNotConnected)
+		return
+	}
+
+	session, errS := client.StartSession()
+	if errS != nil {
+		logger.LogDebug.Error("[transaction] : ", errS, getCurrentFuncInfo(1))
+		err = newError("", "Transaction", errS)
+		return
+	}
+	defer session.EndSession(ctx)
+
+	_, errT := session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (any, error) {
+		return nil, fn(sessCtx)
+	}, opts...)
+	if errT != nil {
+		logger.LogDebug.Error("[transaction] : ", errT, getCurrentFuncInfo(1))
+		err = newError("", "Transaction", errT)
+		return
+	}
+	return
+}
+
+/**
+ * @title report whether ctx carries a session started by Transaction
+ */
+func InTransaction(ctx context.Context) bool {
+	return mongo.SessionFromContext(ctx) != nil
+}
@@ -0,0 +1,333 @@
+package orm
+
+import (
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Update is a chainable update document builder, pass it to Update, UpdateMultiple, FindAndUpdate or Upsert
+// instead of a model to use update operators other than $set
+type Update struct {
+	operators bson.D
+	// err of SetFields, returned when the update is used
+	err error
+}
+
+/**
+ * @title create an empty update document
+ */
+func NewUpdate() *Update {
+	return &Update{operators: bson.D{}}
+}
+
+/**
+ * @title start an update with $set
+ * @example orm.Set("name", "neil").Inc("age", 1).Push("tags", "x")
+ */
+func Set(field string, value any) *Update {
+	return NewUpdate().Set(field, value)
+}
+
+func (u *Update) add(operator string, field string, value any) *Update {
+	for i, op := range u.operators {
+		if op.Key == operator {
+			fields := op.Value.(bson.D)
+			u.operators[i].Value = append(fields, bson.E{Key: field, Value: value})
+			return u
+		}
+	}
+	u.operators = append(u.operators, bson.E{Key: operator, Value: bson.D{{Key: field, Value: value}}})
+	return u
+}
+
+/**
+ * @title set a field, nil value stores null
+ */
+func (u *Update) Set(field string, value any) *Update {
+	return u.add("$set", field, value)
+}
+
+/**
+ * @title set non-empty fields of a model or a document of fields
+ * @param data any *T or map, ex: &User{Name: &name}, bson.M{"name": "neil"}
+ */
+func (u *Update) SetFields(data any) *Update {
+	fields, err := toDocument(data)
+	if err != nil {
+		u.err = err
+		return u
+	}
+	for _, key := range sortedKeys(fields) {
+		u.Set(key, fields[key])
+	}
+	return u
+}
+
+/**
+ * @title set a field only when the document is inserted by upsert
+ */
+func (u *Update) SetOnInsert(field string, value any) *Update {
+	return u.add("$setOnInsert", field, value)
+}
+
+/**
+ * @title remove fields
+ */
+func (u *Update) Unset(fields ...string) *Update {
+	for _, field := range fields {
+		u.add("$unset", field, "")
+	}
+	return u
+}
+
+/**
+ * @title increase a numeric field, negative amount to decrease
+ */
+func (u *Update) Inc(field string, amount any) *Update {
+	return u.add("$inc", field, amount)
+}
+
+/**
+ * @title multiply a numeric field
+ */
+func (u *Update) Mul(field string, factor any) *Update {
+	return u.add("$mul", field, factor)
+}
+
+/**
+ * @title set a field to value if value is less than the current value
+ */
+func (u *Update) Min(field string, value any) *Update {
+	return u.add("$min", field, value)
+}
+
+/**
+ * @title set a field to value if value is greater than the current value
+ */
+func (u *Update) Max(field string, value any) *Update {
+	return u.add("$max", field, value)
+}
+
+/**
+ * @title set a field to the current date of server
+ * @param fields ...string fields stored as date
+ */
+func (u *Update) CurrentDate(fields ...string) *Update {
+	for _, field := range fields {
+		u.add("$currentDate", field, true)
+	}
+	return u
+}
+
+/**
+ * @title rename a field
+ */
+func (u *Update) Rename(field string, newName string) *Update {
+	return u.add("$rename", field, newName)
+}
+
+/**
+ * @title append values to an array field
+ */
+func (u *Update) Push(field string, values ...any) *Update {
+	if len(values) == 1 {
+		return u.add("$push", field, values[0])
+	}
+	return u.add("$push", field, bson.M{"$each": values})
+}
+
+/**
+ * @title append values to an array field if they are not in it yet
+ */
+func (u *Update) AddToSet(field string, values ...any) *Update {
+	if len(values) == 1 {
+		return u.add("$addToSet", field, values[0])
+	}
+	return u.add("$addToSet", field, bson.M{"$each": values})
+}
+
+/**
+ * @title remove elements of an array field equal to value or matching a condition
+ * @param condition any value or condition, ex: "x", bson.M{"$gte": 6}
+ */
+func (u *Update) Pull(field string, condition any) *Update {
+	return u.add("$pull", field, condition)
+}
+
+/**
+ * @title remove all elements of an array field equal to one of values
+ */
+func (u *Update) PullAll(field string, values ...any) *Update {
+	return u.add("$pullAll", field, values)
+}
+
+/**
+ * @title remove the first element of an array field
+ */
+func (u *Update) PopFirst(field string) *Update {
+	return u.add("$pop", field, -1)
+}
+
+/**
+ * @title remove the last element of an array field
+ */
+func (u *Update) PopLast(field string) *Update {
+	return u.add("$pop", field, 1)
+}
+
+/**
+ * @title get the update document
+ */
+func (u *Update) Document() bson.D {
+	return u.operators
+}
+
+// has report whether any operator changes field
+func (u *Update) has(field string) bool {
+	for _, op := range u.operators {
+		for _, e := range op.Value.(bson.D) {
+			if e.Key == field || strings.HasPrefix(e.Key, field+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updateDocument build the update document of data: *Update as it is, *T or a document of fields by $set.
+// BeforeUpdate hook of data is called and updated_at is refreshed
+func (e *Eloquent[T]) updateDocument(ctx context.Context, operation string, data any) (update any, err error) {
+	if errH := beforeUpdate(ctx, data); errH != nil {
+		err = e.errMsg(operation, errH)
+		return
+	}
+
+	switch value := data.(type) {
+	case *Update:
+		if value.err != nil {
+			err = e.errMsg(operation, value.err)
+			return
+		}
+		stamps, errT := e.timestampValues()
+		if errT != nil {
+			err = e.errMsg(operation, errT)
+			return
+		}
+		updatedAt := e.settings.timestamps.updatedAt
+		stamp, ok := stamps[updatedAt]
+		if !ok || value.has(updatedAt) {
+			update = value.Document()
+			return
+		}
+		clone := &Update{operators: append(bson.D{}, value.operators...)}
+		// copy fields of operators, value may be reused
+		for i, op := range clone.operators {
+			clone.operators[i].Value = append(bson.D{}, op.Value.(bson.D)...)
+		}
+		update = clone.Set(updatedAt, stamp).Document()
+	case *T:
+		if errT := e.timestamps.touch(value, false); errT != nil {
+			err = e.errMsg(operation, errT)
+			return
+		}
+		fields, errD := modelDocument(value)
+		if errD != nil {
+			err = e.errMsg(operation, errD)
+			return
+		}
+		update = bson.M{"$set": fields}
+	default:
+		fields, errD := toDocument(data)
+		if errD != nil {
+			err = e.errMsg(operation, errD)
+			return
+		}
+		stamps, errT := e.timestampValues()
+		if errT != nil {
+			err = e.errMsg(operation, errT)
+			return
+		}
+		updatedAt := e.settings.timestamps.updatedAt
+		if stamp, ok := stamps[updatedAt]; ok && fields[updatedAt] == nil {
+			fields[updatedAt] = stamp
+		}
+		update = bson.M{"$set": fields}
+	}
+	return
+}
+
+// insertFields add fields to $setOnInsert of an update document built by updateDocument, fields changed by other operators are skipped
+func insertFields(update any, fields bson.M) any {
+	operators := bson.D{}
+	switch value := update.(type) {
+	case bson.D:
+		operators = value
+	case bson.M:
+		for _, key := range sortedKeys(value) {
+			operators = append(operators, bson.E{Key: key, Value: value[key]})
+		}
+	}
+
+	// copy fields of operators, update of *Update is not cloned
+	clone := &Update{}
+	for _, op := range operators {
+		switch value := op.Value.(type) {
+		case bson.D:
+			clone.operators = append(clone.operators, bson.E{Key: op.Key, Value: append(bson.D{}, value...)})
+		case bson.M:
+			opFields := bson.D{}
+			for _, key := range sortedKeys(value) {
+				opFields = append(opFields, bson.E{Key: key, Value: value[key]})
+			}
+			clone.operators = append(clone.operators, bson.E{Key: op.Key, Value: opFields})
+		}
+	}
+
+	for _, key := range sortedKeys(fields) {
+		if !clone.has(key) {
+			clone.SetOnInsert(key, fields[key])
+		}
+	}
+	return clone.Document()
+}
+
+/**
+ * @title increase a numeric field of matched documents
+ * @param idOrFilter any _id string or query condition
+ * @param amount ...int default=1
+ * @return modifiedCount int modified document count
+ */
+func (e *Eloquent[T]) Increment(ctx context.Context, idOrFilter any, field string, amount ...int) (modifiedCount int, err error) {
+	step := 1
+	if len(amount) > 0 {
+		step = amount[0]
+	}
+	modifiedCount, err = e.increment(ctx, "Increment", idOrFilter, field, step)
+	return
+}
+
+/**
+ * @title decrease a numeric field of matched documents
+ * @param idOrFilter any _id string or query condition
+ * @param amount ...int default=1
+ * @return modifiedCount int modified document count
+ */
+func (e *Eloquent[T]) Decrement(ctx context.Context, idOrFilter any, field string, amount ...int) (modifiedCount int, err error) {
+	step := 1
+	if len(amount) > 0 {
+		step = amount[0]
+	}
+	modifiedCount, err = e.increment(ctx, "Decrement", idOrFilter, field, -step)
+	return
+}
+
+func (e *Eloquent[T]) increment(ctx context.Context, operation string, idOrFilter any, field string, amount int) (modifiedCount int, err error) {
+	filter, err := e.idFilter(operation, idOrFilter)
+	if err != nil {
+		return
+	}
+	modifiedCount, err = e.updateMany(ctx, operation, filter, NewUpdate().Inc(field, amount))
+	return
+}
@@ -0,0 +1,377 @@
+package orm
+
+import (
+	"context"
+
+	"github.com/LIOU2021/go-eloquent-mongodb/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// upsertMarkerField is set on insert by an upsert with a given _id, then removed
+const upsertMarkerField = "_orm_upserted"
+
+/**
+ * @title update the first document matched by filter, or insert one built from equality conditions of filter and data. no hooks are called
+ * @param filter any query condition, ex: bson.M{"email": "neil@example.com"}. it should match at most one document
+ * @param data any *T or a document of fields, ex: bson.M{"name": "neil"}, fields are set by $set. or *Update, ex: orm.Set("name", "neil").Inc("logins", 1)
+ * @return model *T document after the change
+ * @return created bool true if the document was inserted
+ * @return err error fail message from query
+ */
+func (e *Eloquent[T]) Upsert(ctx context.Context, filter any, data any) (model *T, created bool, err error) {
+	if value, ok := data.(*T); ok {
+		if errT := e.timestamps.touch(value, false); errT != nil {
+			err = e.errMsg("Upsert", errT)
+			return
+		}
+	}
+
+	model, created, err = e.upsert(ctx, "Upsert", filter, data, nil)
+	return
+}
+
+/**
+ * @title get the first document matched by filter, or insert one built from equality conditions of filter and defaults.
+ * the existing document is not changed. BeforeInsert hook of defaults is called before the query, AfterInsert hook only if created
+ * @param filter any query condition, ex: bson.M{"email": "neil@example.com"}. it should match at most one document
+ * @param defaults *T fields of the new document, nil for filter fields only
+ * @return model *T found or created document
+ * @return created bool true if the document was inserted
+ * @return err error fail message from query
+ */
+func (e *Eloquent[T]) FirstOrCreate(ctx context.Context, filter any, defaults *T) (model *T, created bool, err error) {
+	if defaults == nil {
+		defaults = new(T)
+	}
+	if errH := beforeInsert(ctx, defaults); errH != nil {
+		err = e.errMsg("FirstOrCreate", errH)
+		return
+	}
+	if errT := e.timestamps.touch(defaults, true); errT != nil {
+		err = e.errMsg("FirstOrCreate", errT)
+		return
+	}
+
+	model, created, err = e.upsert(ctx, "FirstOrCreate", filter, nil, defaults)
+	if err != nil || !created {
+		return
+	}
+
+	if errH := afterInsert(ctx, model); errH != nil {
+		err = e.errMsg("FirstOrCreate", errH)
+		return
+	}
+	return
+}
+
+/**
+ * @title update the first document matched by filter with data, or insert one built from equality conditions of filter and data.
+ * BeforeUpdate hook of data is called before the query, then AfterInsert or AfterUpdate hook of the result
+ * @param filter any query condition, ex: bson.M{"email": "neil@example.com"}. it should match at most one document
+ * @param data *T fields to set, empty fields are skipped by omitempty
+ * @return model *T document after the change
+ * @return created bool true if the document was inserted
+ * @return err error fail message from query
+ */
+func (e *Eloquent[T]) UpdateOrCreate(ctx context.Context, filter any, data *T) (model *T, created bool, err error) {
+	if errH := beforeUpdate(ctx, data); errH != nil {
+		err = e.errMsg("UpdateOrCreate", errH)
+		return
+	}
+	if errT := e.timestamps.touch(data, false); errT != nil {
+		err = e.errMsg("UpdateOrCreate", errT)
+		return
+	}
+
+	model, created, err = e.upsert(ctx, "UpdateOrCreate", filter, data, nil)
+	if err != nil {
+		return
+	}
+
+	errH := afterUpdate(ctx, model)
+	if created {
+		errH = afterInsert(ctx, model)
+	}
+	if errH != nil {
+		err = e.errMsg("UpdateOrCreate", errH)
+		return
+	}
+	return
+}
+
+// upsert run FindOneAndUpdate with upsert, fields of set are set by $set, fields of setOnInsert only on insert.
+// a generated _id, or a marker if _id is given, is set on insert, so the returned document tells whether it was created
+func (e *Eloquent[T]) upsert(ctx context.Context, operation string, filter any, set any, setOnInsert any) (model *T, created bool, err error) {
+	coll, errConn := e.collection(operation)
+	if errConn != nil {
+		err = errConn
+		return
+	}
+
+	updating := set != nil
+	operators, _ := set.(*Update)
+	if operators != nil {
+		set = nil
+		if operators.err != nil {
+			err = e.errMsg(operation, operators.err)
+			return
+		}
+	}
+
+	docs := make([]bson.M, 3)
+	for i, data := range []any{set, setOnInsert, filter} {
+		var errD error
+		if docs[i], errD = toDocument(data); errD != nil {
+			logger.LogDebug.Error(e.logTitle, errD, getCurrentFuncInfo(2))
+			err = e.errMsg(operation, errD)
+			return
+		}
+	}
+	setDoc, insertDoc, filterDoc := docs[0], docs[1], docs[2]
+
+	update := bson.M{}
+	if operators != nil {
+		for _, op := range operators.operators {
+			for _, field := range op.Value.(bson.D) {
+				switch op.Key {
+				case "$set":
+					setDoc[field.Key] = field.Value
+				case "$setOnInsert":
+					insertDoc[field.Key] = field.Value
+				default:
+					if update[op.Key] == nil {
+						update[op.Key] = bson.M{}
+					}
+					update[op.Key].(bson.M)[field.Key] = field.Value
+				}
+			}
+		}
+	}
+
+	stamps, errT := e.timestampValues()
+	if errT != nil {
+		err = e.errMsg(operation, errT)
+		return
+	}
+	if updating {
+		updatedAt := e.settings.timestamps.updatedAt
+		if stamps[updatedAt] != nil && setDoc[updatedAt] == nil && (operators == nil || !operators.has(updatedAt)) {
+			setDoc[updatedAt] = stamps[updatedAt]
+		}
+	}
+	for key, value := range stamps {
+		if _, ok := setDoc[key]; !ok && insertDoc[key] == nil && (operators == nil || !operators.has(key)) {
+			insertDoc[key] = value
+		}
+	}
+	// the same path in $set and $setOnInsert is a conflict
+	for key := range setDoc {
+		delete(insertDoc, key)
+	}
+
+	pinnedID, pinned := equalityID(filterDoc)
+	if id, ok := setDoc["_id"]; ok {
+		pinnedID, pinned = id, true
+	}
+	if id, ok := insertDoc["_id"]; ok {
+		pinnedID, pinned = id, true
+	}
+
+	var generatedID any
+	if !pinned {
+		if generatedID, err = e.newID(ctx, operation); err != nil {
+			return
+		}
+		insertDoc["_id"] = generatedID
+	} else if _, ok := setDoc["_id"]; !ok {
+		insertDoc["_id"] = pinnedID
+	}
+
+	// _id is given, a marker only set on insert tells whether the document was created
+	marker := primitive.NewObjectID()
+	if pinned {
+		insertDoc[upsertMarkerField] = marker
+	}
+
+	if len(setDoc) > 0 {
+		update["$set"] = setDoc
+	}
+	update["$setOnInsert"] = insertDoc
+
+	query := e.scope(filter)
+	if query == nil {
+		query = bson.M{}
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	result := coll.FindOneAndUpdate(ctx, query, update, opts)
+	raw, errU := result.DecodeBytes()
+	if errU != nil {
+		logger.LogDebug.Error(e.logTitle, errU, getCurrentFuncInfo(2))
+		err = e.errMsg(operation, errU)
+		return
+	}
+
+	if pinned {
+		if value, errL := raw.LookupErr(upsertMarkerField); errL == nil {
+			id, isID := value.ObjectIDOK()
+			created = isID && id == marker
+			if raw, errU = withoutField(raw, upsertMarkerField); errU != nil {
+				err = e.errMsg(operation, errU)
+				return
+			}
+			// the marker is removed by its own value, a later change of the document is kept
+			if _, errC := coll.UpdateOne(ctx, bson.M{"_id": raw.Lookup("_id"), upsertMarkerField: value}, bson.M{"$unset": bson.M{upsertMarkerField: ""}}); errC != nil {
+				logger.LogDebug.Error(e.logTitle, errC, getCurrentFuncInfo(2))
+			}
+		}
+	} else {
+		created = idString(raw.Lookup("_id")) == idString(generatedID)
+	}
+
+	model = new(T)
+	if errR := bson.Unmarshal(raw, model); errR != nil {
+		logger.LogDebug.Error(e.logTitle, errR, getCurrentFuncInfo(2))
+		err = e.errMsg(operation, errR)
+		model = nil
+		return
+	}
+	return
+}
+
+// withoutField copy raw without field
+func withoutField(raw bson.Raw, field string) (result bson.Raw, err error) {
+	var doc bson.D
+	if err = bson.Unmarshal(raw, &doc); err != nil {
+		return
+	}
+
+	fields := bson.D{}
+	for _, e := range doc {
+		if e.Key != field {
+			fields = append(fields, e)
+		}
+	}
+	result, err = bson.Marshal(fields)
+	return
+}
+
+// equalityID is the _id of filter when it matches a single value, the upserted document gets it
+func equalityID(filter bson.M) (id any, ok bool) {
+	if id, ok = filter["_id"]; !ok {
+		return
+	}
+
+	var condition bson.M
+	switch value := id.(type) {
+	case bson.M:
+		condition = value
+	case bson.D:
+		condition = value.Map()
+	default:
+		return
+	}
+	for key := range condition {
+		if len(key) > 0 && key[0] == '$' {
+			id, ok = condition["$eq"]
+			if len(condition) > 1 {
+				id, ok = nil, false
+			}
+			return
+		}
+	}
+	return
+}
+
+// insertValues is _id and timestamps of a document inserted by an upsert of filter, _id is not generated if filter gives it
+func (e *Eloquent[T]) insertValues(ctx context.Context, operation string, filter any) (values bson.M, err error) {
+	values, errT := e.timestampValues()
+	if errT != nil {
+		err = e.errMsg(operation, errT)
+		return
+	}
+
+	filterDoc, errD := toDocument(filter)
+	if errD != nil {
+		err = e.errMsg(operation, errD)
+		return
+	}
+	if _, pinned := equalityID(filterDoc); pinned {
+		return
+	}
+
+	id, err := e.newID(ctx, operation)
+	if err != nil {
+		return
+	}
+	values["_id"] = id
+	return
+}
+
+// replacePipeline replace the matched document with replacement by an update pipeline.
+// a replacement upsert can not have $setOnInsert, so fields of inserting missing in replacement, _id and created_at,
+// are set here if the document has none
+func replacePipeline(replacement bson.D, inserting bson.M) bson.A {
+	root := bson.D{}
+	given := map[string]bool{}
+	for _, field := range replacement {
+		given[field.Key] = true
+	}
+	if id, ok := inserting["_id"]; ok {
+		root = append(root, bson.E{Key: "_id", Value: bson.M{"$ifNull": bson.A{"$_id", bson.M{"$literal": id}}}})
+	}
+	for _, field := range replacement {
+		root = append(root, bson.E{Key: field.Key, Value: bson.M{"$literal": field.Value}})
+	}
+	for _, key := range sortedKeys(inserting) {
+		if key != "_id" && !given[key] {
+			root = append(root, bson.E{Key: key, Value: bson.M{"$ifNull": bson.A{"$" + key, bson.M{"$literal": inserting[key]}}}})
+		}
+	}
+	return bson.A{bson.M{"$replaceWith": root}}
+}
+
+// timestampValues is created_at and updated_at of a new document, empty if model has no timestamp
+func (e *Eloquent[T]) timestampValues() (values bson.M, err error) {
+	values = bson.M{}
+	if e.settings.timestamps.disabled {
+		return
+	}
+
+	model := new(T)
+	if err = e.timestamps.touch(model, true); err != nil {
+		return
+	}
+	raw, errM := bson.Marshal(model)
+	if errM != nil {
+		return
+	}
+
+	for _, key := range []string{e.settings.timestamps.createdAt, e.settings.timestamps.updatedAt} {
+		if key == "" {
+			continue
+		}
+		if value, errL := bson.Raw(raw).LookupErr(key); errL == nil {
+			values[key] = value
+		}
+	}
+	return
+}
+
+// toDocument convert model or document to bson.M by bson encoding, nil to an empty document
+func toDocument(data any) (doc bson.M, err error) {
+	doc = bson.M{}
+	if data == nil {
+		return
+	}
+
+	raw, err := bson.Marshal(data)
+	if err != nil {
+		return
+	}
+	err = bson.Unmarshal(raw, &doc)
+	return
+}
@@ -5,7 +5,6 @@ import (
 
 	"github.com/LIOU2021/go-eloquent-mongodb/orm"
 	"github.com/LIOU2021/go-eloquent-mongodb/tests/models"
-	"gopkg.in/mgo.v2/bson"
 )
 
 type UserRepository struct {
@@ -19,28 +18,11 @@ func NewUserRepository() *UserRepository {
 }
 
 func (repo *UserRepository) GetUnderage(age int) (users []*models.User, err error) {
-	filter := bson.M{
-		"age": bson.M{"$lt": age},
-	}
-	users, err = repo.FindMultiple(context.Background(), filter)
+	users, err = repo.Query().Where("age", "<", age).Get(context.Background())
 	return
 }
 
 func (repo *UserRepository) GetOverage(age int) (users []*models.User, err error) {
-	coll := repo.GetCollection()
-
-	filter := bson.M{"age": bson.M{"$gt": age}}
-	cursor, errF := coll.Find(context.TODO(), filter)
-
-	if errF != nil {
-		err = errF
-		return
-	}
-
-	if errA := cursor.All(context.TODO(), &users); errA != nil {
-		err = errA
-		return
-	}
-
+	users, err = repo.Query().Where("age", ">", age).Get(context.Background())
 	return
 }
@@ -2,7 +2,6 @@ package services
 
 import (
 	"context"
-	"time"
 
 	"github.com/LIOU2021/go-eloquent-mongodb/orm"
 	"github.com/LIOU2021/go-eloquent-mongodb/tests/models"
@@ -36,10 +35,6 @@ func (service *UserService) FindMultiple(filter any, opts ...*options.FindOption
 }
 
 func (service *UserService) Insert(user *models.User) (insertId string, err error) {
-	currentTime := time.Now().Unix()
-	user.CreatedAt = &currentTime
-	user.UpdatedAt = &currentTime
-
 	insertId, err = service.repo.Insert(context.Background(), user)
 	return
 }
@@ -62,15 +57,11 @@ func (service *UserService) DeleteMultiple(filter any) (deleteCount int, err err
 func (service *UserService) Update(data *models.User) (updateCount int, err error) {
 	id := *data.ID
 	data.ID = nil
-	currentTime := time.Now().Unix()
-	data.UpdatedAt = &currentTime
 	updateCount, err = service.repo.Update(context.Background(), id, data)
 	return
 }
 
 func (service *UserService) UpdateMultiple(filter any, data *models.User) (updateCount int, err error) {
-	currentTime := time.Now().Unix()
-	data.UpdatedAt = &currentTime
 	updateCount, err = service.repo.UpdateMultiple(context.Background(), filter, data)
 	return
 }
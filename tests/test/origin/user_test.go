@@ -3,15 +3,18 @@ package origin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/LIOU2021/go-eloquent-mongodb/logger"
 	"github.com/LIOU2021/go-eloquent-mongodb/orm"
 	"github.com/LIOU2021/go-eloquent-mongodb/tests/models"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"gopkg.in/mgo.v2/bson"
 
@@ -23,7 +26,9 @@ var testId string
 func TestMain(m *testing.M) {
 	orm.Setup("go-eloquent-mongo", "127.0.0.1", "27017", "")
 	ctx := context.Background()
-	orm.Connect(ctx)
+	if _, err := orm.Connect(ctx); err != nil {
+		logger.LogDebug.Fatal(err)
+	}
 	exitCode := m.Run()
 	defer func() {
 		orm.Disconnect(ctx)
@@ -31,6 +36,48 @@ func TestMain(m *testing.M) {
 	}()
 }
 
+func Test_Connect_Error(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, orm.Ping(ctx), "ping not ok")
+	assert.NoError(t, orm.Disconnect(ctx), "disconnect not ok")
+	assert.True(t, errors.Is(orm.Ping(ctx), orm.ErrNotConnected), "ping after disconnect should fail")
+
+	orm.Setup("go-eloquent-mongo", "", "", "")
+	_, err := orm.Connect(ctx)
+	assert.True(t, errors.Is(err, orm.ErrInvalidConfig), "invalid config not reported")
+
+	orm.Setup("go-eloquent-mongo", "127.0.0.1", "27017", "")
+	_, err = orm.Connect(ctx)
+	assert.NoError(t, err, "reconnect not ok")
+}
+
+func Test_Named_Connection(t *testing.T) {
+	ctx := context.Background()
+	orm.AddConnection("analytics", orm.NewConfig("go-eloquent-mongo-analytics", orm.WithHost("127.0.0.1", "27017")))
+	_, err := orm.ConnectTo(ctx, "analytics")
+	assert.NoError(t, err, "connect analytics not ok")
+
+	eventOrm := orm.NewEloquent[models.User]("events", orm.OnConnection("analytics"))
+	assert.Equal(t, "go-eloquent-mongo-analytics", eventOrm.GetCollection().Database().Name(), "db of connection not used")
+
+	archiveOrm := orm.NewEloquent[models.User]("events", orm.OnConnection("analytics"), orm.OnDatabase("go-eloquent-mongo-archive"))
+	assert.Equal(t, "go-eloquent-mongo-archive", archiveOrm.GetCollection().Database().Name(), "OnDatabase not used")
+
+	name := "event"
+	insertId, err := eventOrm.Insert(ctx, &models.User{Name: &name})
+	assert.NoError(t, err, "insert not ok")
+
+	_, err = orm.NewEloquent[models.User]("events").Find(ctx, insertId)
+	assert.True(t, errors.Is(err, orm.ErrNotFound), "document should not be in default connection db")
+
+	deleteCount, err := eventOrm.Delete(ctx, insertId)
+	assert.NoError(t, err, "delete not ok")
+	assert.Equal(t, 1, deleteCount, "delete not working")
+
+	_, err = orm.NewEloquent[models.User]("events", orm.OnConnection("missing")).Find(ctx, insertId)
+	assert.True(t, errors.Is(err, orm.ErrNotConnected), "missing connection not reported")
+}
+
 func Test_User_Insert_A_Document(t *testing.T) {
 
 	userOrm := orm.NewEloquent[models.User]("users")
@@ -53,6 +100,77 @@ func Test_User_Insert_A_Document(t *testing.T) {
 	assert.True(t, insertId != "", "id was null")
 }
 
+func Test_User_Insert_Timestamps(t *testing.T) {
+
+	userOrm := orm.NewEloquent[models.User]("users")
+
+	name := "timestamps"
+	age := 18
+	data := &models.User{
+		Name: &name,
+		Age:  &age,
+	}
+	insertId, err := userOrm.Insert(context.Background(), data)
+	assert.NoError(t, err, "insert not ok")
+	assert.NotNil(t, data.CreatedAt, "created_at not filled")
+	assert.NotNil(t, data.UpdatedAt, "updated_at not filled")
+
+	user, err := userOrm.Find(context.Background(), insertId)
+	assert.NoError(t, err, "find not ok")
+	assert.Equal(t, *data.CreatedAt, *user.CreatedAt, "created_at not saved")
+
+	deleteCount, err := userOrm.Delete(context.Background(), insertId)
+	assert.NoError(t, err, "delete not ok")
+	assert.Equal(t, 1, deleteCount, "delete not working")
+}
+
+var errEmptyName = errors.New("name is required")
+
+type hookUser struct {
+	ID        *string `bson:"_id,omitempty"`
+	Name      *string `bson:"name,omitempty"`
+	Age       *int    `bson:"age,omitempty"`
+	CreatedAt *int64  `bson:"created_at,omitempty"`
+	UpdatedAt *int64  `bson:"updated_at,omitempty"`
+	found     bool
+}
+
+func (u *hookUser) BeforeInsert(ctx context.Context) error {
+	if u.Name == nil || strings.TrimSpace(*u.Name) == "" {
+		return errEmptyName
+	}
+	name := strings.TrimSpace(*u.Name)
+	u.Name = &name
+	return nil
+}
+
+func (u *hookUser) AfterFind(ctx context.Context) error {
+	u.found = true
+	return nil
+}
+
+func Test_User_Hooks(t *testing.T) {
+
+	userOrm := orm.NewEloquent[hookUser]("users")
+
+	name := "  "
+	_, err := userOrm.Insert(context.Background(), &hookUser{Name: &name})
+	assert.True(t, errors.Is(err, errEmptyName), "BeforeInsert not abort insert")
+
+	name = "  hook  "
+	insertId, err := userOrm.Insert(context.Background(), &hookUser{Name: &name})
+	assert.NoError(t, err, "insert not ok")
+
+	user, err := userOrm.Find(context.Background(), insertId)
+	assert.NoError(t, err, "find not ok")
+	assert.Equal(t, "hook", *user.Name, "BeforeInsert not normalize name")
+	assert.True(t, user.found, "AfterFind not called")
+
+	deleteCount, err := userOrm.Delete(context.Background(), insertId)
+	assert.NoError(t, err, "delete not ok")
+	assert.Equal(t, 1, deleteCount, "delete not working")
+}
+
 func Test_User_Insert_Multiple(t *testing.T) {
 
 	userOrm := orm.NewEloquent[models.User]("users")
@@ -81,6 +199,79 @@ func Test_User_Insert_Multiple(t *testing.T) {
 	assert.Equal(t, count, len(InsertedIDs), "insertMultiple count miss match")
 }
 
+func Test_User_Transaction(t *testing.T) {
+
+	userOrm := orm.NewEloquent[models.User]("users")
+	errRollback := errors.New("rollback")
+
+	name := "transaction"
+	age := 20
+	var insertId string
+	err := orm.Transaction(context.Background(), func(txCtx context.Context) error {
+		assert.True(t, orm.InTransaction(txCtx), "txCtx has no session")
+
+		id, err := userOrm.Insert(txCtx, &models.User{Name: &name, Age: &age})
+		if err != nil {
+			return err
+		}
+		insertId = id
+
+		if _, err := userOrm.Find(txCtx, insertId); err != nil {
+			return err
+		}
+		return errRollback
+	})
+
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(20) {
+		t.Skip("transaction needs replica set")
+	}
+
+	assert.True(t, errors.Is(err, errRollback), "callback error not returned")
+
+	_, err = userOrm.Find(context.Background(), insertId)
+	assert.True(t, errors.Is(err, orm.ErrNotFound), "transaction not rollback")
+}
+
+func Test_User_Soft_Delete(t *testing.T) {
+
+	userOrm := orm.NewEloquent[models.User]("users", orm.WithSoftDeletes())
+
+	name := "soft delete"
+	age := 40
+	insertId, err := userOrm.Insert(context.Background(), &models.User{Name: &name, Age: &age})
+	assert.NoError(t, err, "insert not ok")
+
+	deleteCount, err := userOrm.Delete(context.Background(), insertId)
+	assert.NoError(t, err, "delete not ok")
+	assert.Equal(t, 1, deleteCount, "soft delete not working")
+
+	_, err = userOrm.Find(context.Background(), insertId)
+	assert.True(t, errors.Is(err, orm.ErrNotFound), "soft deleted document was found")
+
+	user, err := userOrm.WithTrashed().Find(context.Background(), insertId)
+	assert.NoError(t, err, "withTrashed find not ok")
+	assert.Equal(t, name, *user.Name, "withTrashed find not working")
+
+	count, err := userOrm.OnlyTrashed().Count(context.Background(), bson.M{"name": name})
+	assert.NoError(t, err, "onlyTrashed count not ok")
+	assert.Equal(t, 1, count, "onlyTrashed count not working")
+
+	restoredCount, err := userOrm.Restore(context.Background(), insertId)
+	assert.NoError(t, err, "restore not ok")
+	assert.Equal(t, 1, restoredCount, "restore not working")
+
+	_, err = userOrm.Find(context.Background(), insertId)
+	assert.NoError(t, err, "restored document not found")
+
+	deleteCount, err = userOrm.ForceDelete(context.Background(), insertId)
+	assert.NoError(t, err, "force delete not ok")
+	assert.Equal(t, 1, deleteCount, "force delete not working")
+
+	_, err = userOrm.WithTrashed().Find(context.Background(), insertId)
+	assert.True(t, errors.Is(err, orm.ErrNotFound), "force deleted document was found")
+}
+
 func Test_User_Find_A_Document(t *testing.T) {
 	userOrm := orm.NewEloquent[models.User]("users")
 	userFind, err := userOrm.Find(context.Background(), testId)
@@ -92,6 +283,23 @@ func Test_User_Find_A_Document(t *testing.T) {
 	}
 }
 
+func Test_User_Find_Error(t *testing.T) {
+	userOrm := orm.NewEloquent[models.User]("users")
+
+	userFind, err := userOrm.Find(context.Background(), "642d5b2298ba2bb73c55e5c4")
+	assert.Nil(t, userFind, "userFind was not nil")
+	assert.True(t, errors.Is(err, orm.ErrNotFound), "not found error not match")
+	assert.True(t, errors.Is(err, mongo.ErrNoDocuments), "driver error not wrapped")
+
+	var ormErr *orm.Error
+	assert.True(t, errors.As(err, &ormErr), "error is not *orm.Error")
+	assert.Equal(t, "users", ormErr.Collection, "collection not match")
+	assert.Equal(t, "Find", ormErr.Operation, "operation not match")
+
+	_, err = userOrm.Find(context.Background(), "not-a-object-id")
+	assert.True(t, errors.Is(err, orm.ErrInvalidID), "invalid id error not match")
+}
+
 func Test_User_Find_Multiple_Document(t *testing.T) {
 
 	userOrm := orm.NewEloquent[models.User]("users")
@@ -290,6 +498,216 @@ func Test_User_Paginate_Filter(t *testing.T) {
 	t.Log(string(jsonResponse))
 }
 
+func Test_User_Paginate_Sort(t *testing.T) {
+
+	userOrm := orm.NewEloquent[models.User]("users")
+	pagination, err := userOrm.Paginate(context.Background(), 3, 1, bson.M{}, options.Find().SetSort(bson.M{"age": 1}))
+	assert.NoError(t, err, "paginate not ok")
+
+	preAge := -1
+	for _, value := range pagination.Data {
+		assert.GreaterOrEqual(t, *value.Age, preAge, "order by age asc fail")
+		preAge = *value.Age
+	}
+
+	pastLast, err := userOrm.Paginate(context.Background(), 3, pagination.LastPage+1, bson.M{})
+	assert.NoError(t, err, "paginate not ok")
+	assert.Equal(t, 0, pastLast.From, "From err")
+	assert.Equal(t, 0, pastLast.To, "To err")
+
+	simple, err := userOrm.SimplePaginate(context.Background(), 3, 1, bson.M{})
+	assert.NoError(t, err, "simple paginate not ok")
+	assert.Equal(t, pagination.LastPage > 1, simple.HasMore, "HasMore err")
+}
+
+func Test_User_Cursor_Paginate(t *testing.T) {
+
+	userOrm := orm.NewEloquent[models.User]("users")
+	total, err := userOrm.Count(context.Background(), nil)
+	assert.NoError(t, err, "count not ok")
+
+	seen := map[string]bool{}
+	cursor := ""
+	for {
+		page, err := userOrm.CursorPaginate(context.Background(), 4, cursor, bson.M{}, "-created_at")
+		assert.NoError(t, err, "cursor paginate not ok")
+		for _, value := range page.Data {
+			assert.False(t, seen[*value.ID], "document repeated in pages")
+			seen[*value.ID] = true
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.Equal(t, total, len(seen), "cursor paginate should walk every document")
+}
+
+func Test_User_Query_Builder(t *testing.T) {
+
+	userOrm := orm.NewEloquent[models.User]("users")
+
+	users, err := userOrm.Query().
+		Where("age", ">=", 11).
+		Where("age", "<=", 51).
+		OrWhere("name", "c8_0").
+		OrderBy("age", "desc").
+		Limit(3).
+		Get(context.Background())
+	assert.NoError(t, err, "query get not ok")
+	assert.Equal(t, 3, len(users), "query limit not working")
+
+	preAge := 9999
+	for _, value := range users {
+		assert.LessOrEqual(t, *value.Age, preAge, "order by age desc fail")
+		preAge = *value.Age
+	}
+
+	count, err := userOrm.Query().WhereIn("name", "c8_0", "c8_1", "c8_2").Count(context.Background())
+	assert.NoError(t, err, "query count not ok")
+	assert.Equal(t, 3, count, "query whereIn not working")
+
+	first, err := userOrm.Query().WhereBetween("age", 20, 40).OrderBy("age").First(context.Background())
+	assert.NoError(t, err, "query first not ok")
+	assert.Equal(t, 21, *first.Age, "query whereBetween not working")
+}
+
+func Test_User_Aggregate(t *testing.T) {
+
+	userOrm := orm.NewEloquent[models.User]("users")
+
+	type ageGroup struct {
+		Age   int `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	groups, err := orm.Aggregate[ageGroup](context.Background(), userOrm, orm.NewPipeline().
+		Match(bson.M{"age": bson.M{"$gte": 30}}).
+		Group("$age", bson.M{"count": bson.M{"$sum": 1}}).
+		Sort("_id"))
+	assert.NoError(t, err, "aggregate not ok")
+
+	total := 0
+	preAge := 0
+	for _, group := range groups {
+		assert.GreaterOrEqual(t, group.Age, 30, "match stage not working")
+		assert.Greater(t, group.Age, preAge, "sort stage not working")
+		preAge = group.Age
+		total += group.Count
+	}
+
+	count, err := userOrm.Count(context.Background(), bson.M{"age": bson.M{"$gte": 30}})
+	assert.NoError(t, err, "count not ok")
+	assert.Equal(t, count, total, "group count not working")
+
+	// $collStats must be the first stage, the soft delete $match goes after it
+	softOrm := orm.NewEloquent[models.User]("users", orm.WithSoftDeletes())
+	stats, err := orm.Aggregate[bson.M](context.Background(), softOrm, mongo.Pipeline{
+		{{Key: "$collStats", Value: bson.M{"count": bson.M{}}}},
+	})
+	assert.NoError(t, err, "aggregate with $collStats not ok")
+	assert.Len(t, stats, 1, "$collStats not working")
+}
+
+func Test_User_Scalar_Aggregates(t *testing.T) {
+
+	userOrm := orm.NewEloquent[models.User]("users")
+	filter := bson.M{"age": bson.M{"$gte": 30}}
+
+	ages, err := orm.ValuesAs[int](userOrm.Pluck(context.Background(), "age", filter))
+	assert.NoError(t, err, "pluck not ok")
+
+	total := 0
+	minAge := ages[0]
+	for _, age := range ages {
+		total += age
+		if age < minAge {
+			minAge = age
+		}
+	}
+
+	sum, err := userOrm.Sum(context.Background(), "age", filter)
+	assert.NoError(t, err, "sum not ok")
+	assert.Equal(t, float64(total), sum, "sum err")
+
+	avg, err := userOrm.Avg(context.Background(), "age", filter)
+	assert.NoError(t, err, "avg not ok")
+	assert.InDelta(t, float64(total)/float64(len(ages)), avg, 0.0001, "avg err")
+
+	min, err := userOrm.Min(context.Background(), "age", filter)
+	assert.NoError(t, err, "min not ok")
+	assert.Equal(t, fmt.Sprint(minAge), fmt.Sprint(min), "min err")
+
+	distinct, err := orm.ValuesAs[int](userOrm.Distinct(context.Background(), "age", filter))
+	assert.NoError(t, err, "distinct not ok")
+	assert.LessOrEqual(t, len(distinct), len(ages), "distinct err")
+}
+
+func Test_User_Upsert(t *testing.T) {
+
+	userOrm := orm.NewEloquent[models.User]("users")
+	name := fmt.Sprintf("upsert-%d", time.Now().UnixNano())
+	age := 20
+
+	user, created, err := userOrm.FirstOrCreate(context.Background(), bson.M{"name": name}, &models.User{Age: &age})
+	assert.NoError(t, err, "first or create not ok")
+	assert.True(t, created, "first or create should create")
+
+	newAge := 21
+	updated, created, err := userOrm.UpdateOrCreate(context.Background(), bson.M{"name": name}, &models.User{Age: &newAge})
+	assert.NoError(t, err, "update or create not ok")
+	assert.False(t, created, "update or create should update")
+	assert.Equal(t, *user.ID, *updated.ID, "update or create updated another document")
+	assert.Equal(t, newAge, *updated.Age, "update or create not updated")
+
+	_, err = userOrm.Delete(context.Background(), *user.ID)
+	assert.NoError(t, err, "delete not ok")
+}
+
+func Test_User_Ensure_Indexes(t *testing.T) {
+
+	userOrm := orm.NewEloquent[models.User]("users", orm.WithIndexes(
+		orm.Index("name", "-age"),
+		orm.Index("created_at").Named("created_at_idx"),
+	))
+
+	report, err := userOrm.EnsureIndexes(context.Background())
+	assert.NoError(t, err, "ensure indexes not ok")
+	t.Logf("ensure indexes report : %+v", report)
+
+	report, err = userOrm.EnsureIndexes(context.Background())
+	assert.NoError(t, err, "ensure indexes not ok")
+	assert.Equal(t, 0, len(report.Created), "index should not be created again")
+	assert.Equal(t, 0, len(report.Dropped), "index should not be dropped")
+
+	userOrm = orm.NewEloquent[models.User]("users", orm.WithIndexes(
+		orm.Index("name", "-age"),
+		orm.Index("created_at").Named("created_at_idx").Sparse(),
+	))
+	report, err = userOrm.EnsureIndexes(context.Background())
+	assert.NoError(t, err, "ensure indexes not ok")
+	assert.Equal(t, []string{"created_at_idx"}, report.Dropped, "drifted index not dropped")
+	assert.Equal(t, []string{"created_at_idx"}, report.Created, "drifted index not recreated")
+
+	// same keys under another name
+	userOrm = orm.NewEloquent[models.User]("users", orm.WithIndexes(
+		orm.Index("name", "-age").Named("name_age_idx"),
+		orm.Index("created_at").Named("created_at_idx").Sparse(),
+	))
+	report, err = userOrm.EnsureIndexes(context.Background())
+	assert.NoError(t, err, "ensure indexes with an index of the same keys not ok")
+	assert.Equal(t, 0, len(report.Created), "index of the same keys should not be created")
+	assert.NotContains(t, report.Unmanaged, "name_1_age_-1", "index of the same keys should be managed")
+
+	userOrm = orm.NewEloquent[models.User]("users", orm.WithIndexes(
+		orm.Index("name", "-age").Named("name_age_idx").Sparse(),
+		orm.Index("created_at").Named("created_at_idx").Sparse(),
+	))
+	report, err = userOrm.EnsureIndexes(context.Background())
+	assert.NoError(t, err, "ensure indexes with a drifted index of the same keys not ok")
+	assert.Equal(t, []string{"name_1_age_-1"}, report.Dropped, "drifted index of the same keys not dropped")
+	assert.Equal(t, []string{"name_age_idx"}, report.Created, "drifted index of the same keys not recreated")
+}
+
 func Test_User_Update_Multiple_Document_By_Full(t *testing.T) {
 
 	userOrm := orm.NewEloquent[models.User]("users")
@@ -24,7 +24,9 @@ var testId string
 func TestMain(m *testing.M) {
 	orm.Setup("go-eloquent-mongo", "127.0.0.1", "27017", "")
 	ctx := context.Background()
-	orm.Connect(ctx)
+	if _, err := orm.Connect(ctx); err != nil {
+		logger.LogDebug.Fatal(err)
+	}
 	exitCode := m.Run()
 	defer func() {
 		orm.Disconnect(ctx)